@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// Accounts tracks the consequences of executions for each trader: their net
+// position in each symbol, its average cost, the cash paid and received, the
+// fees charged, and realized and unrealized profit and loss. Prices, cash
+// and fees are in Price units.
+type Accounts struct {
+	// Optional function that returns the price to mark positions in a symbol
+	// to. Defaults to the symbol's last trade price.
+	Mark func(symbol string) (float64, bool)
+
+	// Optional reference data, by symbol, used to write prices and cash as
+	// decimal values in WriteCSV. Symbols without an instrument are written
+	// in Price units.
+	Instruments map[string]*Instrument
+
+	positions  map[accountKey]*Position
+	lastTrades map[string]Price
+}
+
+type accountKey struct {
+	trader, symbol string
+}
+
+// Position is one trader's account in one symbol.
+type Position struct {
+	Trader      string
+	Symbol      string
+	Quantity    int64   // Net quantity, long positive.
+	AverageCost float64 // Average price of the open quantity.
+	Cash        int64   // Received for sales less paid for purchases, before fees.
+	Fees        float64 // Fees charged less rebates paid.
+	Realized    float64 // Profit and loss on closed quantity, net of fees.
+	Unrealized  float64 // Profit and loss on open quantity at the mark price.
+	MarkPrice   float64 // 0 if the symbol has no mark price.
+}
+
+// NewAccounts returns an empty set of accounts.
+func NewAccounts() *Accounts {
+	return &Accounts{
+		positions:  make(map[accountKey]*Position),
+		lastTrades: make(map[string]Price),
+	}
+}
+
+// MidpointMark returns a mark function for Accounts that marks to the
+// midpoint of the best Buy and Sell prices in an engine's book, falling back
+// to the last trade price when either side is empty.
+func MidpointMark(e *Engine) func(symbol string) (float64, bool) {
+	return func(symbol string) (float64, bool) {
+		bid, ok := e.peekBest(Bid)
+		if !ok {
+			return float64(e.lastPrice), e.lastPrice != 0
+		}
+		ask, ok := e.peekBest(Ask)
+		if !ok {
+			return float64(e.lastPrice), e.lastPrice != 0
+		}
+		return (float64(bid) + float64(ask)) / 2, true
+	}
+}
+
+// Record updates the accounts with an execution report. It can be used
+// directly as an Engine.Execute callback. The execution's fee, if any, is
+// added to Fees and taken from Realized.
+func (a *Accounts) Record(x Execution) {
+	key := accountKey{x.trader, x.symbol}
+	pos, ok := a.positions[key]
+	if !ok {
+		pos = &Position{Trader: x.trader, Symbol: x.symbol}
+		a.positions[key] = pos
+	}
+	a.lastTrades[x.symbol] = x.price
+	pos.Fees += x.fee
+	pos.Realized -= x.fee
+
+	price := float64(x.price)
+	change := int64(x.size)
+	if x.side == Ask {
+		change = -change
+	}
+	pos.Cash -= change * int64(x.price)
+
+	if pos.Quantity == 0 || (pos.Quantity > 0) == (change > 0) {
+		// Opening or adding to a position.
+		open, added := abs(pos.Quantity), abs(change)
+		pos.AverageCost = (pos.AverageCost*float64(open) + price*float64(added)) / float64(open+added)
+		pos.Quantity += change
+		return
+	}
+
+	// Reducing, closing or reversing a position.
+	closed := abs(change)
+	if closed > abs(pos.Quantity) {
+		closed = abs(pos.Quantity)
+	}
+	if pos.Quantity > 0 {
+		pos.Realized += (price - pos.AverageCost) * float64(closed)
+	} else {
+		pos.Realized += (pos.AverageCost - price) * float64(closed)
+	}
+
+	wasLong := pos.Quantity > 0
+	pos.Quantity += change
+	switch {
+	case pos.Quantity == 0:
+		pos.AverageCost = 0
+	case (pos.Quantity > 0) != wasLong:
+		pos.AverageCost = price // Reversed: the rest opened a new position.
+	}
+}
+
+// Position returns a trader's account in a symbol, marked to market.
+func (a *Accounts) Position(trader, symbol string) Position {
+	pos, ok := a.positions[accountKey{trader, symbol}]
+	if !ok {
+		return Position{Trader: trader, Symbol: symbol}
+	}
+	return a.marked(pos)
+}
+
+// Positions returns every account, marked to market, ordered by trader and
+// then symbol.
+func (a *Accounts) Positions() []Position {
+	positions := make([]Position, 0, len(a.positions))
+	for _, pos := range a.positions {
+		positions = append(positions, a.marked(pos))
+	}
+	sort.Slice(positions, func(i, j int) bool {
+		if positions[i].Trader != positions[j].Trader {
+			return positions[i].Trader < positions[j].Trader
+		}
+		return positions[i].Symbol < positions[j].Symbol
+	})
+	return positions
+}
+
+// Return a copy of a position with its unrealized profit and loss computed
+// at the current mark price.
+func (a *Accounts) marked(pos *Position) Position {
+	marked := *pos
+
+	var mark float64
+	var ok bool
+	if a.Mark != nil {
+		mark, ok = a.Mark(pos.Symbol)
+	} else {
+		var last Price
+		last, ok = a.lastTrades[pos.Symbol]
+		mark = float64(last)
+	}
+	if ok {
+		marked.MarkPrice = mark
+		marked.Unrealized = (mark - pos.AverageCost) * float64(pos.Quantity)
+		if marked.Unrealized == 0 {
+			marked.Unrealized = 0 // Not -0 for short positions.
+		}
+	}
+	return marked
+}
+
+// WriteCSV writes every account as CSV, with a header line:
+//
+//	trader,symbol,quantity,average_cost,cash,fees,realized,unrealized,mark_price
+func (a *Accounts) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"trader", "symbol", "quantity", "average_cost", "cash", "fees", "realized", "unrealized", "mark_price"})
+	for _, pos := range a.Positions() {
+		cash := strconv.FormatInt(pos.Cash, 10)
+		if in := a.Instruments[pos.Symbol]; in != nil {
+			cash = strconv.FormatFloat(in.decimal(float64(pos.Cash)), 'f', -1, 64)
+			pos.AverageCost = in.decimal(pos.AverageCost)
+			pos.Fees = in.decimal(pos.Fees)
+			pos.Realized = in.decimal(pos.Realized)
+			pos.Unrealized = in.decimal(pos.Unrealized)
+			pos.MarkPrice = in.decimal(pos.MarkPrice)
+		}
+		record := []string{
+			pos.Trader,
+			pos.Symbol,
+			strconv.FormatInt(pos.Quantity, 10),
+			strconv.FormatFloat(pos.AverageCost, 'f', -1, 64),
+			cash,
+			strconv.FormatFloat(pos.Fees, 'f', -1, 64),
+			strconv.FormatFloat(pos.Realized, 'f', -1, 64),
+			strconv.FormatFloat(pos.Unrealized, 'f', -1, 64),
+			strconv.FormatFloat(pos.MarkPrice, 'f', -1, 64),
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
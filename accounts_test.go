@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccounts(t *testing.T) {
+	var e Engine
+	e.Reset()
+	accounts := NewAccounts()
+	e.Execute = accounts.Record
+
+	e.Limit(Order{"JPM", "MAX", Ask, 100, 100})
+	e.Limit(Order{"JPM", "MAX", Ask, 110, 50})
+	e.Limit(Order{"JPM", "XAM", Bid, 100, 60})
+	e.Limit(Order{"JPM", "XAM", Bid, 110, 40})
+	assert.Equal(t, Position{"XAM", "JPM", 100, 104, -10400, 0, 0, 600, 110}, accounts.Position("XAM", "JPM"))
+
+	// Selling more than the position realizes the profit and loss on it and
+	// opens a short position with the rest.
+	e.Limit(Order{"JPM", "BLK", Bid, 90, 150})
+	e.Limit(Order{"JPM", "XAM", Ask, 90, 150})
+	assert.Equal(t, []Position{
+		{"BLK", "JPM", 150, 90, -13500, 0, 0, 0, 90},
+		{"MAX", "JPM", -100, 104, 10400, 0, 0, 1400, 90},
+		{"XAM", "JPM", -50, 90, 3100, 0, -1400, 0, 90},
+	}, accounts.Positions())
+
+	var buf bytes.Buffer
+	assert.NoError(t, accounts.WriteCSV(&buf))
+	assert.Equal(t, "trader,symbol,quantity,average_cost,cash,fees,realized,unrealized,mark_price\n"+
+		"BLK,JPM,150,90,-13500,0,0,0,90\n"+
+		"MAX,JPM,-100,104,10400,0,0,1400,90\n"+
+		"XAM,JPM,-50,90,3100,0,-1400,0,90\n", buf.String())
+
+	// Mark to the midpoint of the book.
+	e.Limit(Order{"JPM", "BLK", Bid, 80, 10})
+	accounts.Mark = MidpointMark(&e)
+	assert.Equal(t, Position{"XAM", "JPM", -50, 90, 3100, 0, -1400, -250, 95}, accounts.Position("XAM", "JPM"))
+
+	// Write decimal prices and cash for instruments with a scale.
+	accounts.Instruments = map[string]*Instrument{"JPM": {Symbol: "JPM", Scale: 2}}
+	buf.Reset()
+	assert.NoError(t, accounts.WriteCSV(&buf))
+	assert.Equal(t, "trader,symbol,quantity,average_cost,cash,fees,realized,unrealized,mark_price\n"+
+		"BLK,JPM,150,0.9,-135,0,0,7.5,0.95\n"+
+		"MAX,JPM,-100,1.04,104,0,0,9,0.95\n"+
+		"XAM,JPM,-50,0.9,31,0,-14,-2.5,0.95\n", buf.String())
+
+	assert.Equal(t, Position{Trader: "ZZZ", Symbol: "JPM"}, accounts.Position("ZZZ", "JPM"))
+}
+
+func TestAccountsFees(t *testing.T) {
+	var e Engine
+	e.Reset()
+	e.Fees = NewFeeSchedule([]FeeTier{{0, FeeRates{Maker: -0.25, Taker: 0.5}}}, nil)
+	accounts := NewAccounts()
+	e.Execute = accounts.Record
+
+	e.Limit(Order{"JPM", "MAX", Ask, 100, 100})
+	e.Limit(Order{"JPM", "XAM", Bid, 100, 100})
+	e.Limit(Order{"JPM", "MAX", Bid, 110, 100})
+	e.Limit(Order{"JPM", "XAM", Ask, 110, 100})
+	assert.Equal(t, []Position{
+		{"MAX", "JPM", 0, 0, -1000, -50, -950, 0, 110},
+		{"XAM", "JPM", 0, 0, 1000, 100, 900, 0, 110},
+	}, accounts.Positions())
+
+	var buf bytes.Buffer
+	accounts.Instruments = map[string]*Instrument{"JPM": {Symbol: "JPM", Scale: 2}}
+	assert.NoError(t, accounts.WriteCSV(&buf))
+	assert.Equal(t, "trader,symbol,quantity,average_cost,cash,fees,realized,unrealized,mark_price\n"+
+		"MAX,JPM,0,0,-10,-0.5,-9.5,0,1.1\n"+
+		"XAM,JPM,0,0,10,1,9,0,1.1\n", buf.String())
+}
+
+func TestMidpointMarkDuringMatching(t *testing.T) {
+	var e Engine
+	e.Reset()
+	accounts := NewAccounts()
+	accounts.Mark = MidpointMark(&e)
+	var marks []float64
+	e.Execute = func(x Execution) {
+		accounts.Record(x)
+		marks = append(marks, accounts.Position(x.trader, x.symbol).MarkPrice)
+	}
+
+	// Marking from the Execute callback must not disturb the search for the
+	// next price level.
+	e.Limit(Order{"JPM", "MAX", Ask, 100, 10})
+	e.Limit(Order{"JPM", "MAX", Ask, 102, 10})
+	e.Limit(Order{"JPM", "BLK", Bid, 90, 10})
+	e.Limit(Order{"JPM", "XAM", Bid, 102, 20})
+	assert.Equal(t, []Level{{90, 10, 1}}, e.Depth(Bid))
+	assert.Empty(t, e.Depth(Ask))
+	assert.Len(t, marks, 4)
+	assert.NoError(t, e.Check())
+}
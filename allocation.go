@@ -0,0 +1,127 @@
+package main
+
+import "math/bits"
+
+// Allocation selects how an incoming order that can't fill every resting
+// order at a price level shares its quantity among them.
+type Allocation int
+
+const (
+	FIFO            Allocation = iota // Time priority.
+	ProRata                           // In proportion to size.
+	ProRataTopOrder                   // The first order in time priority, then pro-rata.
+	SizeTime                          // Part in time priority, then pro-rata.
+)
+
+// AllocationPolicy configures the allocation of incoming orders to resting
+// orders, set as Engine.AllocationPolicy.
+//
+// Pro-rata shares are rounded down, and shares smaller than MinShare are
+// rounded down to zero. Any quantity left over by rounding is allocated in
+// time priority. Displayed orders are always filled before hidden orders,
+// and all-or-none orders only fill in time priority. If self-trade
+// prevention applies to any order at a level, the level is allocated in
+// time priority.
+type AllocationPolicy struct {
+	Allocation Allocation
+	MinShare   Size // Defaults to 1.
+
+	// SizeTime: the percentage of the incoming quantity allocated in time
+	// priority before the rest is shared pro-rata.
+	TimePercent int
+}
+
+// Match an incoming order against one of a price point's lists according
+// to the allocation policy. Reports false without matching if the policy
+// does not apply, because the order would fill every order in the list, and
+// the list should be matched in time priority instead.
+func (e *Engine) matchAllocated(head *orderBookEntry, orderID OrderID, order Order, group string, aggressor Side, price Price, orderSize Size) bool {
+	policy := &e.AllocationPolicy
+	var entries []*orderBookEntry
+	var available []Size
+	var volume Size
+	for bookEntry := head; bookEntry != nil; bookEntry = bookEntry.next {
+		if bookEntry.size == 0 || bookEntry.side == order.side || e.attrs(bookEntry.id).aon {
+			continue
+		}
+		if e.SelfTradePrevention != STPNone && e.group(bookEntry) == group {
+			return false
+		}
+		entries = append(entries, bookEntry)
+		available = append(available, bookEntry.size)
+		volume += bookEntry.size
+	}
+	if orderSize >= volume {
+		return false
+	}
+
+	allocated := make([]Size, len(entries))
+	quantity := orderSize
+	switch policy.Allocation {
+	case ProRataTopOrder:
+		quantity = shareFIFO(available[:1], allocated[:1], quantity)
+	case SizeTime:
+		timeQuantity := Size(uint64(quantity) * uint64(policy.TimePercent) / 100)
+		quantity = quantity - timeQuantity + shareFIFO(available, allocated, timeQuantity)
+	}
+	shareProRata(available, allocated, quantity, policy.MinShare)
+
+	for i, bookEntry := range entries {
+		fill := allocated[i]
+		if fill == 0 {
+			continue
+		}
+		if order.side == Bid {
+			execute(e.Execute, e.Fees, order.symbol, order.trader, bookEntry.trader, aggressor, price, fill)
+		} else {
+			execute(e.Execute, e.Fees, order.symbol, bookEntry.trader, order.trader, aggressor, price, fill)
+		}
+		e.recordFill(orderID, bookEntry.id, price, fill)
+		e.fillEntry(bookEntry, fill)
+	}
+	e.lastPrice = price
+	return true
+}
+
+// Allocate quantity in time priority to orders with the given available
+// sizes, adding to their allocations and reducing what is available. Returns
+// the quantity left over.
+func shareFIFO(available, allocated []Size, quantity Size) Size {
+	for i := range available {
+		share := available[i]
+		if quantity < share {
+			share = quantity
+		}
+		allocated[i] += share
+		available[i] -= share
+		quantity -= share
+	}
+	return quantity
+}
+
+// Share quantity among orders in proportion to their available sizes, which
+// must total more than quantity, adding to their allocations. Shares are
+// rounded down, and shares smaller than minShare to zero; the rest is
+// allocated in time priority.
+func shareProRata(available, allocated []Size, quantity, minShare Size) {
+	var volume Size
+	for _, size := range available {
+		volume += size
+	}
+	if volume == 0 {
+		return
+	}
+
+	left := quantity
+	for i, size := range available {
+		hi, lo := bits.Mul64(uint64(quantity), uint64(size))
+		share, _ := bits.Div64(hi, lo, uint64(volume))
+		if Size(share) < minShare {
+			continue
+		}
+		allocated[i] += Size(share)
+		available[i] -= Size(share)
+		left -= Size(share)
+	}
+	shareFIFO(available, allocated, left)
+}
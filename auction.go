@@ -0,0 +1,256 @@
+package main
+
+// Phase is the trading phase of an Engine.
+type Phase int
+
+const (
+	Continuous  Phase = iota // Incoming orders are matched immediately.
+	CallAuction              // Orders are collected without matching until Uncross.
+)
+
+func (p Phase) String() string {
+	switch p {
+	case Continuous:
+		return "Continuous"
+	case CallAuction:
+		return "CallAuction"
+	default:
+		return "Unknown"
+	}
+}
+
+// AuctionResult describes the outcome, or while orders are still being
+// collected the likely outcome, of a call auction.
+type AuctionResult struct {
+	Price     Price // 0 if the book is not crossed.
+	Volume    Size  // Quantity executed at Price.
+	Imbalance Size  // Quantity left unmatched at Price on ImbalanceSide.
+
+	ImbalanceSide Side
+}
+
+// Phase returns the engine's trading phase.
+func (e *Engine) Phase() Phase {
+	return e.phase
+}
+
+// StartAuction begins collecting orders for a call auction during continuous
+// trading, moving the session to StateAuction. Until Uncross, limit orders
+// rest in the book without matching, even if the book becomes crossed, and an
+// EventIndicative event is published after every order and cancel. Market,
+// stop, pegged, post-only, minimum quantity and all-or-none orders are
+// rejected.
+func (e *Engine) StartAuction() error {
+	return e.SetState(StateAuction)
+}
+
+// Uncross ends a call auction in StatePreOpen or StateAuction. All crossing
+// orders trade at the single price that maximizes the executed volume, and
+// the session moves to StateContinuous.
+//
+// Ties between prices are broken by the smallest imbalance, then by market
+// pressure (the highest price if every tied price leaves unmatched Buy
+// orders, the lowest if every tied price leaves unmatched Sell orders), then
+// by distance from the reference price, which is the last trade price or
+// failing that the middle of the tied prices.
+//
+// All-or-none orders left in the book from continuous trading sit out the
+// auction, since it can't guarantee to fill them completely.
+func (e *Engine) Uncross() AuctionResult {
+	if e.state != StatePreOpen && e.state != StateAuction {
+		return AuctionResult{}
+	}
+	result := e.indicative()
+	e.SetState(StateContinuous)
+	return result
+}
+
+// Compute the auction price, volume and imbalance if the book were uncrossed
+// now.
+func (e *Engine) indicative() AuctionResult {
+	lo, ok := e.bestAsk()
+	if !ok {
+		return AuctionResult{}
+	}
+	hi, ok := e.bestBid()
+	if !ok || lo > hi {
+		return AuctionResult{}
+	}
+
+	// The price levels in [lo, hi], with cumulative Sell quantity at or below
+	// each, and Buy quantity at or above it.
+	type level struct {
+		price          Price
+		supply, demand Size
+	}
+	var levels []level
+	for price, ok := e.pricePoints.next(lo); ok && price <= hi; price, ok = e.pricePoints.next(price + 1) {
+		ppEntry := e.pricePoints.get(price)
+		ask, bid := e.volumeAt(ppEntry, Ask), e.volumeAt(ppEntry, Bid)
+		if ask > 0 || bid > 0 {
+			levels = append(levels, level{price: price, supply: ask, demand: bid})
+		}
+	}
+	for i := 1; i < len(levels); i++ {
+		levels[i].supply += levels[i-1].supply
+	}
+	for i := len(levels) - 2; i >= 0; i-- {
+		levels[i].demand += levels[i+1].demand
+	}
+
+	// The candidate prices: each level, and the gaps between levels, where
+	// supply and demand are those of the levels either side.
+	type candidate struct {
+		from, to       Price
+		supply, demand Size
+	}
+	var candidates []candidate
+	for i, l := range levels {
+		if i > 0 && l.price > levels[i-1].price+1 {
+			candidates = append(candidates, candidate{levels[i-1].price + 1, l.price - 1, levels[i-1].supply, l.demand})
+		}
+		candidates = append(candidates, candidate{l.price, l.price, l.supply, l.demand})
+	}
+
+	// Find the prices that maximize volume and then minimize the imbalance.
+	var best []candidate
+	var bestVolume, bestImbalance Size
+	for _, c := range candidates {
+		volume, imbalance := c.supply, c.demand-c.supply
+		if c.demand < c.supply {
+			volume, imbalance = c.demand, c.supply-c.demand
+		}
+		if len(best) == 0 || volume > bestVolume || volume == bestVolume && imbalance < bestImbalance {
+			best, bestVolume, bestImbalance = best[:0], volume, imbalance
+		}
+		if volume == bestVolume && imbalance == bestImbalance {
+			best = append(best, c)
+		}
+	}
+	if bestVolume == 0 {
+		return AuctionResult{} // Crossed only around all-or-none orders.
+	}
+
+	buyPressure, sellPressure := true, true
+	for _, c := range best {
+		buyPressure = buyPressure && c.demand > c.supply
+		sellPressure = sellPressure && c.supply > c.demand
+	}
+
+	var price Price
+	var chosen candidate
+	switch {
+	case buyPressure:
+		chosen = best[len(best)-1]
+		price = chosen.to
+	case sellPressure:
+		chosen = best[0]
+		price = chosen.from
+	default:
+		reference := e.lastPrice
+		if reference == 0 {
+			reference = best[0].from + (best[len(best)-1].to-best[0].from)/2
+		}
+		for i, c := range best {
+			closest := reference
+			if closest < c.from {
+				closest = c.from
+			} else if closest > c.to {
+				closest = c.to
+			}
+			if i == 0 || distance(closest, reference) < distance(price, reference) {
+				price, chosen = closest, c
+			}
+		}
+	}
+
+	result := AuctionResult{Price: price, Volume: bestVolume, Imbalance: bestImbalance}
+	if chosen.supply > chosen.demand {
+		result.ImbalanceSide = Ask
+	}
+	return result
+}
+
+// Execute every Buy order at or above the auction price against Sell orders
+// at or below it, in price and then time priority, at the auction price.
+// All-or-none orders on either side are left in the book.
+func (e *Engine) uncrossAt(price Price) {
+	var bids []*orderBookEntry
+	for level, ok := e.pricePoints.prev(e.bidMax); ok && level >= price; level, ok = e.pricePoints.prev(level - 1) {
+		ppEntry := e.pricePoints.get(level)
+		for _, bookEntry := range [...]*orderBookEntry{ppEntry.listHead, ppEntry.hiddenHead} {
+			for ; bookEntry != nil; bookEntry = bookEntry.next {
+				if bookEntry.size > 0 && bookEntry.side == Bid && !e.attrs(bookEntry.id).aon {
+					bids = append(bids, bookEntry)
+				}
+			}
+		}
+	}
+
+	for _, bid := range bids {
+		order := Order{symbol: bid.symbol, trader: bid.trader, side: Bid, price: price}
+		total := bid.size + bid.reserve
+		remaining := e.match(bid.id, order, total, &OrderOptions{STPGroup: e.attrs(bid.id).group})
+
+		e.fillEntry(bid, total-remaining)
+
+		if remaining > 0 {
+			break // No more crossing Sell orders.
+		}
+	}
+}
+
+// Remove a filled quantity from an order book entry, taking it from the
+// displayed size first and then any iceberg reserve. An iceberg order whose
+// displayed slice is filled is replenished at the back of the queue.
+func (e *Engine) fillEntry(entry *orderBookEntry, fill Size) {
+	if fill < entry.size {
+		entry.size -= fill
+		return
+	}
+	entry.reserve -= fill - entry.size
+	entry.size = 0
+	if entry.reserve > 0 {
+		ppEntry := e.pricePoints.get(entry.price)
+		ppRemoveOrder(ppEntry, entry)
+		attrs := e.attrs(entry.id)
+		entry.size = attrs.peak
+		if entry.reserve < entry.size {
+			entry.size = entry.reserve
+		}
+		entry.reserve -= entry.size
+		ppInsertOrder(ppEntry, entry, attrs.hidden)
+	}
+}
+
+// Publish the indicative auction result while an auction is being called.
+func (e *Engine) publishIndicative() {
+	if e.phase != CallAuction || e.MarketData == nil {
+		return
+	}
+	result := e.indicative()
+	e.publish(MarketDataEvent{Type: EventIndicative, Side: result.ImbalanceSide, Price: result.Price,
+		Size: result.Volume, Imbalance: result.Imbalance})
+}
+
+// Return the total outstanding size of the orders on one side of the book at
+// a price point that can take part in an auction, including hidden orders
+// and iceberg reserves but not all-or-none orders.
+func (e *Engine) volumeAt(ppEntry *pricePoint, side Side) Size {
+	var volume Size
+	for _, bookEntry := range [...]*orderBookEntry{ppEntry.listHead, ppEntry.hiddenHead} {
+		for ; bookEntry != nil; bookEntry = bookEntry.next {
+			if bookEntry.size > 0 && bookEntry.side == side && !e.attrs(bookEntry.id).aon {
+				volume += bookEntry.size + bookEntry.reserve
+			}
+		}
+	}
+	return volume
+}
+
+func distance(a, b Price) Price {
+	if a < b {
+		return b - a
+	}
+	return a - b
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCallAuction(t *testing.T) {
+	var e Engine
+	e.Reset()
+	executions := recordExecutions(&e)
+	var events []MarketDataEvent
+	e.MarketData = func(event MarketDataEvent) { events = append(events, event) }
+
+	e.StartAuction()
+	assert.Equal(t, CallAuction, e.Phase())
+	e.Limit(Order{"JPM", "B1", Bid, 102, 100})
+	e.Limit(Order{"JPM", "B2", Bid, 101, 50})
+	e.Limit(Order{"JPM", "S1", Ask, 99, 60})
+	e.Limit(Order{"JPM", "S2", Ask, 100, 70})
+	e.Limit(Order{"JPM", "S3", Ask, 102, 40})
+	assert.Empty(t, *executions)
+	assert.NoError(t, e.Check())
+
+	_, err := e.Submit(Order{"JPM", "B3", Bid, 0, 10}, OrderOptions{Market: true})
+	assert.Equal(t, RejectInvalidOptions, rejectReason(err))
+
+	// 130 can trade at both 100 and 101, leaving 20 Buy orders unmatched, so
+	// the higher price is chosen.
+	assert.Equal(t, MarketDataEvent{Type: EventIndicative, Side: Bid, Price: 101, Size: 130, Imbalance: 20}, events[len(events)-1])
+
+	assert.Equal(t, AuctionResult{Price: 101, Volume: 130, Imbalance: 20, ImbalanceSide: Bid}, e.Uncross())
+	assert.Equal(t, []Execution{
+		{"JPM", "B1", Bid, 101, 60, Auction, 0}, {"JPM", "S1", Ask, 101, 60, Auction, 0},
+		{"JPM", "B1", Bid, 101, 40, Auction, 0}, {"JPM", "S2", Ask, 101, 40, Auction, 0},
+		{"JPM", "B2", Bid, 101, 30, Auction, 0}, {"JPM", "S2", Ask, 101, 30, Auction, 0},
+	}, *executions)
+	assert.Equal(t, []Level{{101, 20, 1}}, e.Depth(Bid))
+	assert.Equal(t, []Level{{102, 40, 1}}, e.Depth(Ask))
+	assert.Equal(t, Continuous, e.Phase())
+	assert.NoError(t, e.Check())
+}
+
+func TestCallAuctionReferencePrice(t *testing.T) {
+	var e Engine
+
+	// Without a last trade, the middle of the tied prices is chosen.
+	e.Reset()
+	e.StartAuction()
+	e.Limit(Order{"JPM", "B", Bid, 103, 10})
+	e.Limit(Order{"JPM", "S", Ask, 95, 10})
+	assert.Equal(t, AuctionResult{Price: 99, Volume: 10}, e.Uncross())
+
+	e.Reset()
+	e.Limit(Order{"JPM", "S", Ask, 100, 10})
+	e.Limit(Order{"JPM", "B", Bid, 100, 10})
+	e.StartAuction()
+	e.Limit(Order{"JPM", "B", Bid, 103, 10})
+	e.Limit(Order{"JPM", "S", Ask, 95, 10})
+	assert.Equal(t, AuctionResult{Price: 100, Volume: 10}, e.Uncross())
+
+	// Nothing to uncross.
+	e.StartAuction()
+	e.Limit(Order{"JPM", "B", Bid, 99, 10})
+	assert.Equal(t, AuctionResult{}, e.Uncross())
+	assert.Equal(t, []Level{{99, 10, 1}}, e.Depth(Bid))
+}
+
+func TestCallAuctionLeavesAllOrNoneOrders(t *testing.T) {
+	var e Engine
+	e.Reset()
+	executions := recordExecutions(&e)
+
+	// All-or-none orders resting from continuous trading, crossed around
+	// each other.
+	_, err := e.Submit(Order{"JPM", "S1", Ask, 100, 50}, OrderOptions{AllOrNone: true})
+	assert.NoError(t, err)
+	_, err = e.Submit(Order{"JPM", "B1", Bid, 101, 40}, OrderOptions{AllOrNone: true})
+	assert.NoError(t, err)
+
+	e.StartAuction()
+	assert.Equal(t, AuctionResult{}, e.indicative())
+	e.Limit(Order{"JPM", "B2", Bid, 101, 30})
+	assert.Equal(t, AuctionResult{}, e.indicative())
+
+	e.Limit(Order{"JPM", "S2", Ask, 99, 10})
+	assert.Equal(t, AuctionResult{Price: 101, Volume: 10, Imbalance: 20, ImbalanceSide: Bid}, e.Uncross())
+	assert.Equal(t, []Execution{
+		{"JPM", "B2", Bid, 101, 10, Auction, 0}, {"JPM", "S2", Ask, 101, 10, Auction, 0},
+	}, *executions)
+	assert.Equal(t, []Level{{101, 60, 2}}, e.Depth(Bid))
+	assert.Equal(t, []Level{{100, 50, 1}}, e.Depth(Ask))
+	assert.NoError(t, e.Check())
+}
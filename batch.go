@@ -0,0 +1,185 @@
+package main
+
+import "time"
+
+// BatchEngine runs an Engine as a frequent batch auction: orders are
+// collected over a fixed interval, as in a call auction, and at the end of
+// each interval the book is uncrossed at a single price. At the clearing
+// price, the side with more quantity than can trade is filled pro-rata.
+//
+// Batches end on the first call after the interval has elapsed, measured by
+// the clock, so orders that arrive after the end of a batch always go into
+// the next one. Self-trade prevention is not applied in batch auctions, and
+// all-or-none orders left in the book from continuous trading sit them out.
+type BatchEngine struct {
+	*Engine
+	interval time.Duration
+	clock    Clock
+	end      time.Time // End of the current batch.
+}
+
+// NewBatchEngine returns a batch auction engine that uncrosses e at every
+// interval, which must be positive. A nil clock means the wall clock.
+func NewBatchEngine(e *Engine, interval time.Duration, clock Clock) *BatchEngine {
+	if interval <= 0 {
+		panic("non-positive interval for NewBatchEngine")
+	}
+	if clock == nil {
+		clock = systemClock{}
+	}
+	b := &BatchEngine{Engine: e, interval: interval, clock: clock}
+	b.start()
+	return b
+}
+
+// Reset clears the book and starts a new batch.
+func (b *BatchEngine) Reset() {
+	b.Engine.Reset()
+	b.start()
+}
+
+// Limit adds a limit order to the current batch.
+func (b *BatchEngine) Limit(order Order) OrderID {
+	b.Poll()
+	return b.Engine.Limit(order)
+}
+
+// Submit adds an order to the current batch.
+func (b *BatchEngine) Submit(order Order, opts OrderOptions) (OrderID, error) {
+	b.Poll()
+	return b.Engine.Submit(order, opts)
+}
+
+// Cancel an outstanding order.
+func (b *BatchEngine) Cancel(orderID OrderID) {
+	b.Poll()
+	b.Engine.Cancel(orderID)
+}
+
+// MassCancel cancels every outstanding order matching the filter.
+func (b *BatchEngine) MassCancel(filter CancelFilter) []CancelReport {
+	b.Poll()
+	return b.Engine.MassCancel(filter)
+}
+
+// Poll ends the current batch if its interval has elapsed, uncrossing the
+// book and starting a new batch. Reports false if the batch has not ended.
+// Batches only end in StateAuction: while trading is halted or closed, the
+// current batch is held open, and ends on the first call after trading
+// resumes.
+func (b *BatchEngine) Poll() (AuctionResult, bool) {
+	now := b.clock.Now()
+	if b.state != StateAuction || now.Before(b.end) {
+		return AuctionResult{}, false
+	}
+
+	// Skip batches that ended without any orders arriving.
+	b.end = b.end.Add((now.Sub(b.end)/b.interval + 1) * b.interval)
+	return b.uncrossProRata(), true
+}
+
+// Start collecting orders for a new batch, moving the session to
+// StateAuction unless it is halted or closed.
+func (b *BatchEngine) start() {
+	if b.canStartAuction() {
+		b.setState(StateAuction)
+	}
+	b.end = b.clock.Now().Add(b.interval)
+}
+
+// allocation is a quantity allocated to an order in an auction.
+type allocation struct {
+	entry *orderBookEntry
+	size  Size
+}
+
+// Uncross the book at the auction price chosen as for Uncross, filling
+// orders on each side in price priority and sharing the quantity left at
+// the marginal price level pro-rata, then continue collecting orders.
+func (e *Engine) uncrossProRata() AuctionResult {
+	result := e.indicative()
+	if result.Volume == 0 {
+		return result
+	}
+
+	bids := e.allocate(Bid, result.Price, result.Volume)
+	asks := e.allocate(Ask, result.Price, result.Volume)
+	for len(bids) > 0 && len(asks) > 0 {
+		bid, ask := &bids[0], &asks[0]
+		fill := bid.size
+		if ask.size < fill {
+			fill = ask.size
+		}
+		execute(e.Execute, e.Fees, bid.entry.symbol, bid.entry.trader, ask.entry.trader, noAggressor, result.Price, fill)
+		e.recordFill(bid.entry.id, ask.entry.id, result.Price, fill)
+		e.fillEntry(bid.entry, fill)
+		e.fillEntry(ask.entry, fill)
+
+		bid.size -= fill
+		if bid.size == 0 {
+			bids = bids[1:]
+		}
+		ask.size -= fill
+		if ask.size == 0 {
+			asks = asks[1:]
+		}
+	}
+	e.lastPrice = result.Price
+
+	e.debugCheck()
+	return result
+}
+
+// Allocate quantity to the orders on one side of the book, from the best
+// price down to the auction price. Levels that can be filled completely are
+// filled in time priority; the quantity left at the marginal level is shared
+// in proportion to the size of each order there, with any quantity left over
+// by rounding down given out in time priority.
+func (e *Engine) allocate(side Side, price Price, quantity Size) []allocation {
+	var allocations []allocation
+	for level, ok := e.pricePoints.prev(e.bidMax); side == Bid && ok && level >= price && quantity > 0; level, ok = e.pricePoints.prev(level - 1) {
+		allocations, quantity = e.allocateAt(allocations, e.pricePoints.get(level), side, quantity)
+	}
+	for level, ok := e.pricePoints.next(e.askMin); side == Ask && ok && level <= price && quantity > 0; level, ok = e.pricePoints.next(level + 1) {
+		allocations, quantity = e.allocateAt(allocations, e.pricePoints.get(level), side, quantity)
+	}
+	return allocations
+}
+
+// Allocate quantity to the orders on one side of the book at a price point,
+// other than all-or-none orders, returning the quantity left over.
+func (e *Engine) allocateAt(allocations []allocation, ppEntry *pricePoint, side Side, quantity Size) ([]allocation, Size) {
+	volume := e.volumeAt(ppEntry, side)
+	if volume == 0 {
+		return allocations, quantity
+	}
+
+	first := len(allocations)
+	for _, bookEntry := range [...]*orderBookEntry{ppEntry.listHead, ppEntry.hiddenHead} {
+		for ; bookEntry != nil; bookEntry = bookEntry.next {
+			if bookEntry.size > 0 && bookEntry.side == side && !e.attrs(bookEntry.id).aon {
+				allocations = append(allocations, allocation{bookEntry, bookEntry.size + bookEntry.reserve})
+			}
+		}
+	}
+	if volume <= quantity {
+		return allocations, quantity - volume
+	}
+
+	level := allocations[first:]
+	available := make([]Size, len(level))
+	allocated := make([]Size, len(level))
+	for i := range level {
+		available[i] = level[i].size
+	}
+	shareProRata(available, allocated, quantity, 0)
+
+	// Drop orders that were allocated nothing.
+	allocations = allocations[:first]
+	for i, a := range level {
+		if allocated[i] > 0 {
+			allocations = append(allocations, allocation{a.entry, allocated[i]})
+		}
+	}
+	return allocations, 0
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchEngine(t *testing.T) {
+	var e Engine
+	clock := &fakeClock{}
+	b := NewBatchEngine(&e, 100*time.Millisecond, clock)
+	b.Reset()
+	executions := recordExecutions(b)
+
+	b.Limit(Order{"JPM", "A", Bid, 101, 30})
+	b.Limit(Order{"JPM", "B", Bid, 101, 10})
+	b.Limit(Order{"JPM", "C", Bid, 102, 20})
+	b.Limit(Order{"JPM", "S", Ask, 100, 40})
+	b.Limit(Order{"JPM", "T", Ask, 103, 10})
+	_, done := b.Poll()
+	assert.False(t, done)
+	assert.Empty(t, *executions)
+
+	// C's better price is filled in full, and A and B share the rest of the
+	// Sell order in proportion to their size.
+	clock.Advance(100 * time.Millisecond)
+	result, done := b.Poll()
+	assert.True(t, done)
+	assert.Equal(t, AuctionResult{Price: 101, Volume: 40, Imbalance: 20, ImbalanceSide: Bid}, result)
+	assert.Equal(t, []Execution{
+		{"JPM", "C", Bid, 101, 20, Auction, 0}, {"JPM", "S", Ask, 101, 20, Auction, 0},
+		{"JPM", "A", Bid, 101, 15, Auction, 0}, {"JPM", "S", Ask, 101, 15, Auction, 0},
+		{"JPM", "B", Bid, 101, 5, Auction, 0}, {"JPM", "S", Ask, 101, 5, Auction, 0},
+	}, *executions)
+	assert.Equal(t, []Level{{101, 20, 2}}, e.Depth(Bid))
+	assert.Equal(t, []Level{{103, 10, 1}}, e.Depth(Ask))
+
+	// Units left over from rounding go to the earlier order. The batch ends
+	// on the next call after its interval.
+	*executions = nil
+	clock.Advance(50 * time.Millisecond)
+	b.Limit(Order{"JPM", "D", Ask, 101, 7})
+	assert.Empty(t, *executions)
+	clock.Advance(50 * time.Millisecond)
+	b.Cancel(5)
+	assert.Equal(t, []Execution{
+		{"JPM", "A", Bid, 101, 6, Auction, 0}, {"JPM", "D", Ask, 101, 6, Auction, 0},
+		{"JPM", "B", Bid, 101, 1, Auction, 0}, {"JPM", "D", Ask, 101, 1, Auction, 0},
+	}, *executions)
+	assert.Equal(t, []Level{{101, 13, 2}}, e.Depth(Bid))
+	assert.Empty(t, e.Depth(Ask))
+	assert.NoError(t, e.Check())
+
+	// A halted batch isn't uncrossed until trading resumes.
+	*executions = nil
+	b.Limit(Order{"JPM", "E", Ask, 101, 13})
+	assert.NoError(t, b.Halt())
+	clock.Advance(200 * time.Millisecond)
+	_, done = b.Poll()
+	assert.False(t, done)
+	assert.Empty(t, *executions)
+	assert.Equal(t, StateHalted, b.State())
+	assert.NoError(t, b.Resume())
+	_, done = b.Poll()
+	assert.True(t, done)
+	assert.Len(t, *executions, 4)
+	assert.NoError(t, e.Check())
+}
+
+func TestBatchEngineRejectsNonPositiveInterval(t *testing.T) {
+	var e Engine
+	e.Reset()
+	assert.Panics(t, func() { NewBatchEngine(&e, 0, nil) })
+	assert.Panics(t, func() { NewBatchEngine(&e, -time.Second, nil) })
+	assert.Equal(t, StateContinuous, e.State())
+}
+
+func TestBatchEngineLeavesAllOrNoneOrders(t *testing.T) {
+	var e Engine
+	e.Reset()
+	executions := recordExecutions(&e)
+	_, err := e.Submit(Order{"JPM", "S1", Ask, 100, 50}, OrderOptions{AllOrNone: true})
+	assert.NoError(t, err)
+
+	clock := &fakeClock{}
+	b := NewBatchEngine(&e, 100*time.Millisecond, clock)
+	b.Limit(Order{"JPM", "B", Bid, 101, 30})
+	clock.Advance(100 * time.Millisecond)
+	result, done := b.Poll()
+	assert.True(t, done)
+	assert.Equal(t, AuctionResult{}, result)
+	assert.Empty(t, *executions)
+
+	// The all-or-none order isn't given a pro-rata share of the level.
+	b.Limit(Order{"JPM", "S2", Ask, 100, 10})
+	clock.Advance(100 * time.Millisecond)
+	result, done = b.Poll()
+	assert.True(t, done)
+	assert.Equal(t, AuctionResult{Price: 101, Volume: 10, Imbalance: 20, ImbalanceSide: Bid}, result)
+	assert.Equal(t, []Execution{
+		{"JPM", "B", Bid, 101, 10, Auction, 0}, {"JPM", "S2", Ask, 101, 10, Auction, 0},
+	}, *executions)
+	assert.Equal(t, []Level{{101, 20, 1}}, e.Depth(Bid))
+	assert.Equal(t, []Level{{100, 50, 1}}, e.Depth(Ask))
+	assert.NoError(t, e.Check())
+}
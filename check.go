@@ -0,0 +1,131 @@
+package main
+
+import "fmt"
+
+// InvariantError describes an inconsistency in the internal state of the
+// order book, found by Engine.Check.
+type InvariantError struct {
+	Price Price // Offending price level.
+	Msg   string
+}
+
+func (err *InvariantError) Error() string {
+	return fmt.Sprintf("price level %v: %v", err.Price, err.Msg)
+}
+
+func invariantf(price Price, format string, args ...interface{}) error {
+	return &InvariantError{price, fmt.Sprintf(format, args...)}
+}
+
+// Check validates the internal consistency of the order book:
+//
+//   - askMin and bidMax are within the price range.
+//   - Outstanding orders only rest at or below bidMax (Buy orders) or at or
+//     above askMin (Sell orders).
+//   - The book is only crossed around all-or-none orders, or while an
+//     auction is being called.
+//   - Each of a price point's lists is acyclic, ends at its tail, and holds
+//     only displayed or only hidden orders.
+//   - Price points outside the price window are held in the tree, and only
+//     there.
+//   - No order book entry is reachable from more than one place.
+//
+// It returns an *InvariantError describing the first violation found. Check
+// scans every price point, so it is intended for tests and debug builds (see
+// debugChecks) rather than the matching path.
+func (e *Engine) Check() error {
+	if e.askMin < minPrice || e.askMin > maxPrice+1 {
+		return invariantf(e.askMin, "askMin out of range")
+	}
+	if e.bidMax > maxPrice {
+		return invariantf(e.bidMax, "bidMax out of range")
+	}
+	if e.pricePoints.base > maxPrice-windowSize+1 {
+		return invariantf(e.pricePoints.base, "price window out of range")
+	}
+	outside := &e.pricePoints.outside
+	for n := outside.ceiling(0); n != nil; n = outside.ceiling(n.key + 1) {
+		if e.pricePoints.contains(n.key) {
+			return invariantf(n.key, "price point in the tree is inside the price window")
+		}
+	}
+
+	// Best prices of orders that are not all-or-none.
+	bestBid, bestAsk := Price(minPrice-1), maxPrice+1
+
+	seen := make(map[*orderBookEntry]Price, e.curOrderID)
+	for price, ok := e.pricePoints.next(0); ok; price, ok = e.pricePoints.next(price + 1) {
+		ppEntry := e.pricePoints.get(price)
+
+		lists := [...]struct {
+			head, tail *orderBookEntry
+			hidden     bool
+		}{
+			{ppEntry.listHead, ppEntry.listTail, false},
+			{ppEntry.hiddenHead, ppEntry.hiddenTail, true},
+		}
+
+		var live [2]bool
+		for _, list := range lists {
+			if list.head == nil {
+				continue
+			}
+
+			var last *orderBookEntry
+			for bookEntry := list.head; bookEntry != nil; bookEntry = bookEntry.next {
+				if other, ok := seen[bookEntry]; ok {
+					if other == price {
+						return invariantf(price, "cycle in order list")
+					}
+					return invariantf(price, "order book entry also reachable from price level %v", other)
+				}
+				if e.attrs(bookEntry.id).hidden != list.hidden {
+					return invariantf(price, "order book entry queued in the wrong list")
+				}
+				seen[bookEntry] = price
+				if bookEntry.size > 0 {
+					live[bookEntry.side] = true
+					if !e.attrs(bookEntry.id).aon && bookEntry.side == Bid && price > bestBid {
+						bestBid = price
+					}
+					if !e.attrs(bookEntry.id).aon && bookEntry.side == Ask && price < bestAsk {
+						bestAsk = price
+					}
+				}
+				last = bookEntry
+			}
+
+			if last != list.tail {
+				return invariantf(price, "list tail is not the last entry in the list")
+			}
+		}
+
+		if !live[Bid] && !live[Ask] {
+			continue
+		}
+		if price < minPrice || price > maxPrice {
+			return invariantf(price, "outstanding orders outside the price range")
+		}
+		if live[Bid] && price > e.bidMax {
+			return invariantf(price, "outstanding Buy orders above bidMax %v", e.bidMax)
+		}
+		if live[Ask] && price < e.askMin {
+			return invariantf(price, "outstanding Sell orders below askMin %v", e.askMin)
+		}
+	}
+
+	if bestBid >= bestAsk && e.phase == Continuous {
+		return invariantf(bestAsk, "book crossed by orders that are not all-or-none, best bid %v", bestBid)
+	}
+	return nil
+}
+
+// Run Check after every operation in debug builds, panicking on failure.
+func (e *Engine) debugCheck() {
+	if !debugChecks {
+		return
+	}
+	if err := e.Check(); err != nil {
+		panic(err)
+	}
+}
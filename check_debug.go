@@ -0,0 +1,8 @@
+//go:build enginedebug
+// +build enginedebug
+
+package main
+
+// Build with -tags enginedebug to validate the order book after every
+// operation.
+const debugChecks = true
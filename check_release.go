@@ -0,0 +1,6 @@
+//go:build !enginedebug
+// +build !enginedebug
+
+package main
+
+const debugChecks = false
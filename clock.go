@@ -0,0 +1,14 @@
+package main
+
+import "time"
+
+// Clock tells the time. It can be replaced to drive time-dependent features
+// from a simulation or a test instead of the wall clock.
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock is the wall clock.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Feed the same orders to Engine and the reference engine, checking after
+// every operation that both returned the same order ID and reported the same
+// executions, and every depthEvery operations that both books hold the same
+// price levels. Stops at the first divergence.
+func runDifferential(t *testing.T, e *Engine, orders []Order, depthEvery int) {
+	var r referenceEngine
+	e.Reset()
+	r.Reset()
+
+	var got, want []Execution
+	e.SetExecute(func(x Execution) { got = append(got, x) })
+	r.SetExecute(func(x Execution) { want = append(want, x) })
+
+	for i, order := range orders {
+		got, want = got[:0], want[:0]
+		op := fmt.Sprintf("op #%v: %v", i, &order)
+
+		if order.price == 0 {
+			e.Cancel(OrderID(order.size))
+			r.Cancel(OrderID(order.size))
+		} else if !assert.Equal(t, r.Limit(order), e.Limit(order), "order ID mismatch at %v", op) {
+			return
+		}
+
+		if !assert.Equal(t, want, got, "execution mismatch at %v", op) {
+			return
+		}
+
+		if i%depthEvery == 0 || i == len(orders)-1 {
+			if !assert.NoError(t, e.Check(), "invariant violated at %v", op) {
+				return
+			}
+			for _, side := range []Side{Bid, Ask} {
+				if !assert.Equal(t, r.Depth(side), e.Depth(side), "%v depth mismatch at %v", side, op) {
+					return
+				}
+			}
+		}
+	}
+}
+
+func TestDifferentialRandomStreams(t *testing.T) {
+	tight := DefaultMarketModel
+	tight.PriceSpread = 1
+	tight.CrossRatio = 0.4
+
+	cancelHeavy := DefaultMarketModel
+	cancelHeavy.CancelRatio = 0.8
+	cancelHeavy.LotSize = 1
+
+	volatile := DefaultMarketModel
+	volatile.MidVolatility = 5
+	volatile.PriceSpread = 10
+	volatile.CrossRatio = 0.3
+
+	var e Engine // Reused across streams to exercise Reset.
+	for name, model := range map[string]MarketModel{"default": DefaultMarketModel, "tight": tight, "cancelHeavy": cancelHeavy, "volatile": volatile} {
+		for seed := int64(1); seed <= 3; seed++ {
+			model.Seed = seed
+			t.Run(fmt.Sprintf("%v/%v", name, seed), func(t *testing.T) {
+				runDifferential(t, &e, NewGenerator(model).Generate(2000).Orders, 10)
+			})
+		}
+	}
+}
+
+func TestDifferentialScoreFeed(t *testing.T) {
+	var e Engine
+	runDifferential(t, &e, ordersFeed, 1000)
+}
@@ -10,6 +10,9 @@
  *   an instance of struct pricePoint. This data structure maintains a list
  *   of outstanding buy/sell orders at the respective price. Each outstanding
  *   limit order is represented by an instance of struct orderBookEntry.
+ *   (Prices are now 64 bits wide, so the array covers a window of prices
+ *   around the market, and price points outside it are kept in a tree; see
+ *   priceWindow.)
  *
  *   askMin and bidMax are global variables that maintain starting points,
  *   at which the matching algorithm initiates its search.
@@ -67,13 +70,57 @@ type Engine struct {
 	// Optional callback function that is called when a trade is executed.
 	Execute func(Execution)
 
-	// An array of pricePoint structures representing the entire limit order
-	// book.
-	pricePoints [uint(maxPrice) + 1]pricePoint
+	// Optional callback function that is called with market data events.
+	MarketData func(MarketDataEvent)
+
+	// Optional callback function that is called when the engine cancels an
+	// order, rather than in response to a call to Cancel.
+	Cancelled func(CancelReport)
+
+	// How to prevent orders in the same self-trade prevention group from
+	// trading with each other. Defaults to STPNone.
+	SelfTradePrevention STPMode
+
+	// Optional fee schedule used to charge fees on executions.
+	Fees *FeeSchedule
+
+	// How incoming orders are allocated among the resting orders at a price
+	// level. Defaults to FIFO.
+	AllocationPolicy AllocationPolicy
+
+	// Price bands that interrupt continuous trading with a volatility
+	// auction. Disabled by default.
+	Bands VolatilityBands
+
+	// Optional reference data for the engine's symbol, used to validate the
+	// prices and quantities of incoming orders.
+	Instrument *Instrument
+
+	// Optional store recording the status of each accepted order.
+	Orders *OrderStore
+
+	// The pricePoint structures representing the limit order book: an array
+	// for the prices around the market, and a tree for those far from it.
+	pricePoints priceWindow
 
 	curOrderID OrderID // Monotonically-increasing orderID.
-	askMin     uint    // Minimum Ask price.
-	bidMax     uint    // Maximum Bid price.
+	askMin     Price   // Minimum Ask price.
+	bidMax     Price   // Maximum Bid price.
+	lastPrice  Price   // Price of the last execution, 0 if none.
+	phase      Phase   // Continuous unless an auction is being called.
+	state      TradingState
+	haltedFrom TradingState // State before a halt.
+
+	stops []stopOrder   // Untriggered stop orders, in time priority.
+	pegs  []peggedOrder // Resting pegged orders, in time priority.
+
+	// Attributes of the orders that have any, by order ID (see
+	// orderAttributes).
+	attributes map[OrderID]orderAttributes
+
+	// Order IDs of the traders who have mass cancelled their orders, by
+	// trader, including some no longer outstanding (see MassCancel).
+	traderOrders map[string][]OrderID
 
 	// Statically-allocated memory arena for order book entries. This data
 	// structure allows us to avoid the overhead of heap-based memory
@@ -84,156 +131,790 @@ type Engine struct {
 // struct orderBookEntry: Describes a single outstanding limit order (Buy or
 // Sell).
 type orderBookEntry struct {
-	size   Size
-	next   *orderBookEntry
-	trader string
+	size    Size // Displayed size.
+	next    *orderBookEntry
+	symbol  string
+	trader  string
+	id      OrderID
+	price   Price
+	side    Side
+	reserve Size // Iceberg orders: hidden size not yet displayed.
+}
+
+// struct orderAttributes: Describes the parts of an order that few orders
+// use. They are kept out of the arena, so that it stays small, and are only
+// looked up once the engine holds an order that has any.
+type orderAttributes struct {
+	group  string // Self-trade prevention group, if not the trader.
+	peak   Size   // Iceberg orders: size of each displayed slice.
+	hidden bool   // Queued in the price point's hidden list.
+	pegged bool   // Price tracks the book (see peggedOrder).
+	aon    bool   // All-or-none: only matched by orders that fill it completely.
+}
+
+// struct stopOrder: Describes a stop order held off the book until triggered.
+type stopOrder struct {
+	orderID OrderID
+	order   Order
+	opts    OrderOptions
 }
 
 // struct pricePoint: Describes a single price point in the limit order book.
 type pricePoint struct {
 	listHead *orderBookEntry
 	listTail *orderBookEntry
+
+	// Hidden orders, which match only after all displayed orders at this
+	// price.
+	hiddenHead *orderBookEntry
+	hiddenTail *orderBookEntry
 }
 
 const maxNumOrders uint = 1010000
 
 func (e *Engine) Reset() {
-	for _, pricePoint := range e.pricePoints {
-		pricePoint.listHead = nil
-		pricePoint.listTail = nil
-	}
+	e.pricePoints.reset()
 
-	for _, bookEntry := range e.bookEntries {
-		bookEntry.size = 0
-		bookEntry.next = nil
-		bookEntry.trader = ""
+	// Entries past curOrderID have not been used since the last reset.
+	for i := range e.bookEntries[:e.curOrderID+1] {
+		bookEntry := &e.bookEntries[i]
+		*bookEntry = orderBookEntry{}
 	}
 
 	e.curOrderID = 0
-	e.askMin = uint(maxPrice) + 1
-	e.bidMax = uint(minPrice) - 1
+	e.askMin = maxPrice + 1
+	e.bidMax = minPrice - 1
+	e.lastPrice = 0
+	e.stops = nil
+	e.pegs = nil
+	e.attributes = nil
+	e.traderOrders = nil
+	e.phase = Continuous
+	e.state = StateContinuous
+	if e.Orders != nil {
+		e.Orders.reset()
+	}
 }
 
-// Process an incoming limit order.
+// Process an incoming limit order. Orders priced outside [minPrice, maxPrice],
+// or arriving once the order arena is exhausted, are ignored and get order ID
+// 0.
 func (e *Engine) Limit(order Order) OrderID {
+	orderID, _ := e.Submit(order, OrderOptions{})
+	return orderID
+}
+
+// Submit processes an incoming limit order with optional instructions. It
+// returns the new order ID, or a *RejectError if the order was not accepted.
+func (e *Engine) Submit(order Order, opts OrderOptions) (OrderID, error) {
+	orderID, err := e.limit(order, &opts)
+	if len(e.pegs) > 0 {
+		e.repeg()
+	}
+	if e.phase != Continuous {
+		e.publishIndicative()
+	}
+	e.debugCheck()
+	return orderID, err
+}
+
+func (e *Engine) limit(order Order, opts *OrderOptions) (OrderID, error) {
+	if e.state != StateContinuous && e.state != StatePreOpen && e.state != StateAuction {
+		return 0, &RejectError{Reason: RejectTradingState, Detail: e.state.String()}
+	}
+	if !opts.Market && opts.Peg == NoPeg && (order.price < minPrice || order.price > maxPrice) {
+		return 0, &RejectError{Reason: RejectInvalidPrice}
+	}
+	if opts.StopPrice > 0 && (opts.StopPrice < minPrice || opts.StopPrice > maxPrice) {
+		return 0, &RejectError{Reason: RejectInvalidPrice, Detail: "stop price"}
+	}
+	if opts.PostOnly != NotPostOnly && (opts.Market || opts.StopPrice > 0) {
+		return 0, &RejectError{Reason: RejectInvalidOptions, Detail: "post-only market or stop order"}
+	}
+	if opts.Hidden && opts.DisplaySize > 0 {
+		return 0, &RejectError{Reason: RejectInvalidOptions, Detail: "hidden iceberg order"}
+	}
+	if opts.Peg != NoPeg && (opts.Market || opts.StopPrice > 0) {
+		return 0, &RejectError{Reason: RejectInvalidOptions, Detail: "pegged market or stop order"}
+	}
+	if opts.MinQuantity > order.size || opts.MinQuantity > 0 && opts.PostOnly != NotPostOnly {
+		return 0, &RejectError{Reason: RejectInvalidOptions, Detail: "minimum quantity"}
+	}
+	if opts.AllOrNone && opts.DisplaySize > 0 {
+		return 0, &RejectError{Reason: RejectInvalidOptions, Detail: "all-or-none iceberg order"}
+	}
+	if e.phase == CallAuction && (opts.Market || opts.StopPrice > 0 || opts.PostOnly != NotPostOnly ||
+		opts.Peg != NoPeg || opts.MinQuantity > 0 || opts.AllOrNone) {
+		return 0, &RejectError{Reason: RejectInvalidOptions, Detail: "not accepted during call auction"}
+	}
+	if e.Instrument != nil {
+		if err := e.Instrument.validate(order, opts); err != nil {
+			return 0, err
+		}
+	}
+
+	var peg *peggedOrder
+	if opts.Peg != NoPeg {
+		peg = &peggedOrder{side: order.side, limit: order.price, peg: opts.Peg, offset: opts.PegOffset}
+		price, ok := e.pegPrice(peg)
+		if !ok {
+			return 0, &RejectError{Reason: RejectInvalidPrice, Detail: "no peg reference price"}
+		}
+		order.price = price
+	}
+	if opts.PostOnly != NotPostOnly {
+		price, ok := e.postOnlyPrice(order, opts.PostOnly)
+		if !ok {
+			return 0, &RejectError{Reason: RejectWouldCross}
+		}
+		order.price = price
+	}
+	if opts.StopPrice == 0 && (opts.MinQuantity > 0 || opts.AllOrNone) && !e.meetsMinimum(order, opts) {
+		return 0, &RejectError{Reason: RejectMinQuantity}
+	}
+	if uint(e.curOrderID)+1 >= maxNumOrders {
+		return 0, &RejectError{Reason: RejectBookFull}
+	}
+
+	e.curOrderID++
+	orderID := e.curOrderID
+	if e.traderOrders != nil {
+		e.indexOrder(order.trader, orderID)
+	}
+	if e.Orders != nil {
+		e.Orders.accept(orderID, order, opts)
+	}
+
+	if opts.StopPrice > 0 {
+		// Hold the order off the book. Its size, trader, side and price are
+		// recorded in the arena so that it can be cancelled before it is
+		// triggered.
+		entry := &e.bookEntries[orderID]
+		entry.size = order.size
+		entry.symbol = order.symbol
+		entry.trader = order.trader
+		entry.side = order.side
+		entry.price = order.price
+		e.stops = append(e.stops, stopOrder{orderID, order, *opts})
+	} else {
+		e.process(orderID, order, opts)
+	}
+
+	if peg != nil && e.bookEntries[orderID].size > 0 {
+		attrs := e.attrs(orderID)
+		attrs.pegged = true
+		e.setAttrs(orderID, attrs)
+		peg.orderID = orderID
+		peg.price = order.price
+		e.pegs = append(e.pegs, *peg)
+	}
+
+	if len(e.stops) > 0 {
+		e.triggerStops()
+	}
+	return orderID, nil
+}
+
+// Match an accepted order against the book, and record any remainder of a
+// limit order in the book. An all-or-none order that can't be filled
+// completely doesn't trade at all, and no orders trade while an auction is
+// being called.
+func (e *Engine) process(orderID OrderID, order Order, opts *OrderOptions) {
+	orderSize := order.size
+	if e.phase == Continuous && (!opts.AllOrNone || e.available(order, opts, orderSize) == orderSize) {
+		orderSize = e.match(orderID, order, orderSize, opts)
+	}
+	if orderSize == 0 || opts.Market {
+		if e.Orders != nil {
+			e.Orders.cancel(orderID, orderSize, OrderExpired)
+		}
+		return
+	}
+
+	// Record the remainder of the incoming order in the book, displaying no
+	// more than one slice of an iceberg order.
+	entry := &e.bookEntries[orderID]
+	entry.size = orderSize
+	entry.symbol = order.symbol
+	entry.trader = order.trader
+	entry.id = orderID
+	entry.side = order.side
+	var peak Size
+	if opts.DisplaySize > 0 && opts.DisplaySize < orderSize {
+		entry.size = opts.DisplaySize
+		entry.reserve = orderSize - opts.DisplaySize
+		peak = opts.DisplaySize
+	}
+	if opts.STPGroup != "" || peak > 0 || opts.Hidden || opts.AllOrNone {
+		e.setAttrs(orderID, orderAttributes{group: opts.STPGroup, peak: peak, hidden: opts.Hidden, aon: opts.AllOrNone})
+	}
+	e.rest(entry, order.side, order.price)
+}
+
+// Insert an order book entry at the back of the queue at a price point,
+// extending the book if necessary. When the market has moved away from the
+// price window, the window follows it.
+func (e *Engine) rest(entry *orderBookEntry, side Side, price Price) {
+	if !e.pricePoints.contains(price) && !e.marketInWindow() {
+		e.pricePoints.slide(price)
+	}
+
+	entry.price = price
+	ppInsertOrder(e.pricePoints.at(price), entry, e.attrs(entry.id).hidden)
+
+	if side == Bid {
+		if e.bidMax < price {
+			e.bidMax = price
+		}
+	} else {
+		if e.askMin > price {
+			e.askMin = price
+		}
+	}
+}
+
+// Report whether the best Buy or Sell price is in the price window.
+func (e *Engine) marketInWindow() bool {
+	ask, ok := e.bestAsk()
+	if ok && e.pricePoints.contains(ask) {
+		return true
+	}
+	bid, ok := e.bestBid()
+	return ok && e.pricePoints.contains(bid)
+}
 
-	var price Price = order.price
-	var orderSize Size = order.size
+// Match an incoming order against outstanding orders on the opposite side of
+// the book that cross with it, returning the unfilled quantity. Limit orders
+// trade at their own price; market orders cross at any price and trade at
+// the price of each order they match. Matching stops, and a volatility
+// auction begins, before any trade outside the price bands.
+func (e *Engine) match(orderID OrderID, order Order, orderSize Size, opts *OrderOptions) Size {
+	if orderSize == 0 {
+		return 0
+	}
+
+	market := opts.Market
+	group := stpGroup(order, opts)
+	reference := e.lastPrice // Dynamic band reference, before this order trades.
 
+	// Whether every price point so far has been exhausted.
+	exhausted := true
+	var skipped bool
 	if order.side == Bid { // Buy order.
-		// Look for outstanding sell orders that cross with the incoming order.
-		if uint(price) >= e.askMin {
-			ppEntry := &e.pricePoints[e.askMin]
+		limit := order.price
+		if market {
+			limit = maxPrice
+		}
 
-			for {
-				bookEntry := ppEntry.listHead
+		// Start at askMin and proceed upwards, until the order is filled or
+		// no longer crosses.
+		for level, ok := e.pricePoints.next(e.askMin); ok && level <= limit; level, ok = e.pricePoints.next(level + 1) {
+			ppEntry := e.pricePoints.get(level)
+			price := tradePrice(order, opts, level)
+			if e.Bands.enabled() && e.phase == Continuous && !e.withinBands(price, reference) && ppEntry.live(1-order.side) {
+				e.interrupt(order.side, price)
+				return orderSize
+			}
+			orderSize, skipped = e.matchPricePoint(ppEntry, orderID, order, group, price, orderSize)
+			if orderSize == 0 {
+				return 0
+			}
 
-				for bookEntry != nil {
-					if bookEntry.size < orderSize {
-						execute(e.Execute, order.symbol, order.trader, bookEntry.trader, price, bookEntry.size)
+			// We have exhausted all orders at the askMin price point. Move
+			// on to the next price level, unless it still holds all-or-none
+			// orders that this order could not fill.
+			exhausted = exhausted && !skipped
+			if exhausted {
+				e.askMin = level + 1
+				e.prune(level, ppEntry)
+			}
+		}
+	} else { // Sell order.
+		limit := order.price
+		if market {
+			limit = minPrice
+		}
 
-						orderSize -= bookEntry.size
-						bookEntry = bookEntry.next
-					} else {
-						execute(e.Execute, order.symbol, order.trader, bookEntry.trader, price, orderSize)
+		for level, ok := e.pricePoints.prev(e.bidMax); ok && level >= limit; level, ok = e.pricePoints.prev(level - 1) {
+			ppEntry := e.pricePoints.get(level)
+			price := tradePrice(order, opts, level)
+			if e.Bands.enabled() && e.phase == Continuous && !e.withinBands(price, reference) && ppEntry.live(1-order.side) {
+				e.interrupt(order.side, price)
+				return orderSize
+			}
+			orderSize, skipped = e.matchPricePoint(ppEntry, orderID, order, group, price, orderSize)
+			if orderSize == 0 {
+				return 0
+			}
 
-						if bookEntry.size > orderSize {
-							bookEntry.size -= orderSize
-						} else {
-							bookEntry = bookEntry.next
-						}
+			// We have exhausted all orders at the bidMax price point. Move
+			// on to the next price level, unless it still holds all-or-none
+			// orders that this order could not fill.
+			exhausted = exhausted && !skipped
+			if exhausted {
+				e.bidMax = level - 1
+				e.prune(level, ppEntry)
+			}
+		}
+	}
 
-						ppEntry.listHead = bookEntry
-						e.curOrderID++
-						return e.curOrderID
-					}
-				}
+	return orderSize
+}
+
+// Return how much of an incoming order, up to orderSize, could be filled on
+// arrival, without changing the book. Iceberg orders are counted in full,
+// and nothing outside the price bands is counted. With self-trade prevention
+// enabled, nothing beyond the first order in the incoming order's own group
+// is counted.
+func (e *Engine) available(order Order, opts *OrderOptions, orderSize Size) Size {
+	group := ""
+	if e.SelfTradePrevention != STPNone {
+		group = stpGroup(order, opts)
+	}
+
+	remaining := orderSize
+	stopped := false
+	if order.side == Bid {
+		limit := order.price
+		if opts.Market {
+			limit = maxPrice
+		}
+		for level, ok := e.pricePoints.next(e.askMin); ok && level <= limit && remaining > 0 && !stopped; level, ok = e.pricePoints.next(level + 1) {
+			if e.Bands.enabled() && !e.withinBands(tradePrice(order, opts, level), e.lastPrice) {
+				break
+			}
+			remaining, stopped = e.availableAt(e.pricePoints.get(level), order.side, group, remaining)
+		}
+	} else {
+		limit := order.price
+		if opts.Market {
+			limit = minPrice
+		}
+		for level, ok := e.pricePoints.prev(e.bidMax); ok && level >= limit && remaining > 0 && !stopped; level, ok = e.pricePoints.prev(level - 1) {
+			if e.Bands.enabled() && !e.withinBands(tradePrice(order, opts, level), e.lastPrice) {
+				break
+			}
+			remaining, stopped = e.availableAt(e.pricePoints.get(level), order.side, group, remaining)
+		}
+	}
+	return orderSize - remaining
+}
+
+// Report whether an incoming order can be filled on arrival up to its
+// minimum quantity. All-or-none market orders, which can't rest, must be
+// filled completely.
+func (e *Engine) meetsMinimum(order Order, opts *OrderOptions) bool {
+	minQuantity := opts.MinQuantity
+	if opts.AllOrNone && opts.Market {
+		minQuantity = order.size
+	}
+	return minQuantity == 0 || e.available(order, opts, minQuantity) == minQuantity
+}
+
+// Return the price at which a post-only order can rest without crossing the
+// book: its own price, or with PostOnlySlide, one tick behind the best price
+// on the opposite side. Reports false if the order must be rejected.
+func (e *Engine) postOnlyPrice(order Order, mode PostOnly) (Price, bool) {
+	if order.side == Bid {
+		ask, ok := e.bestAsk()
+		if !ok || order.price < ask {
+			return order.price, true
+		}
+		if mode == PostOnlySlide && ask > minPrice {
+			price := ask - 1
+			if e.Instrument != nil {
+				price = e.Instrument.roundDown(price)
+			}
+			return price, price >= minPrice
+		}
+	} else {
+		bid, ok := e.bestBid()
+		if !ok || order.price > bid {
+			return order.price, true
+		}
+		if mode == PostOnlySlide && bid < maxPrice {
+			price := bid + 1
+			if e.Instrument != nil {
+				price = e.Instrument.roundUp(price)
+			}
+			return price, price <= maxPrice
+		}
+	}
+	return 0, false
+}
+
+// Return the lowest price with outstanding Sell orders, discarding any price
+// points at the bottom of the Sell side that hold only filled or cancelled
+// orders. Price points also holding Buy orders, which the book may be crossed
+// around, are kept.
+func (e *Engine) bestAsk() (Price, bool) {
+	for {
+		level, ok := e.pricePoints.next(e.askMin)
+		if !ok || level > maxPrice {
+			e.askMin = maxPrice + 1
+			return 0, false
+		}
+		e.askMin = level
+		ppEntry := e.pricePoints.get(level)
+		if ppEntry.live(Ask) {
+			return level, true
+		}
+		if !ppEntry.live(Bid) {
+			e.pricePoints.remove(level)
+		}
+		e.askMin++
+	}
+}
+
+// Return the highest price with outstanding Buy orders, discarding any price
+// points at the top of the Buy side that hold only filled or cancelled
+// orders. Price points also holding Sell orders are kept.
+func (e *Engine) bestBid() (Price, bool) {
+	for {
+		level, ok := e.pricePoints.prev(e.bidMax)
+		if !ok || level < minPrice {
+			e.bidMax = minPrice - 1
+			return 0, false
+		}
+		e.bidMax = level
+		ppEntry := e.pricePoints.get(level)
+		if ppEntry.live(Bid) {
+			return level, true
+		}
+		if !ppEntry.live(Ask) {
+			e.pricePoints.remove(level)
+		}
+		e.bidMax--
+	}
+}
+
+// Return the best price with outstanding orders on one side of the book
+// without discarding any price points, for callers such as Execute callbacks
+// that may run in the middle of matching.
+func (e *Engine) peekBest(side Side) (Price, bool) {
+	if side == Bid {
+		for price, ok := e.pricePoints.prev(e.bidMax); ok && price >= minPrice; price, ok = e.pricePoints.prev(price - 1) {
+			if e.pricePoints.get(price).live(Bid) {
+				return price, true
+			}
+		}
+	} else {
+		for price, ok := e.pricePoints.next(e.askMin); ok && price <= maxPrice; price, ok = e.pricePoints.next(price + 1) {
+			if e.pricePoints.get(price).live(Ask) {
+				return price, true
+			}
+		}
+	}
+	return 0, false
+}
 
-				// We have exhausted all orders at the askMin price point. Move
-				// on to the next price level.
-				ppEntry.listHead = nil
-				e.askMin++
-				ppEntry = &e.pricePoints[e.askMin]
+// Discard a price point that matching has emptied, so that searches of the
+// book skip it.
+func (e *Engine) prune(price Price, ppEntry *pricePoint) {
+	if ppEntry.listHead == nil && ppEntry.hiddenHead == nil {
+		e.pricePoints.remove(price)
+	}
+}
 
-				if uint(price) < e.askMin {
-					break
+// Release stop orders whose stop price has been reached by the last
+// execution: Buy stops at or above their stop price, Sell stops at or below.
+// Stops triggered together are released one at a time in time priority. Any
+// stops triggered by the executions of a released order (cascading) are
+// queued behind those already triggered.
+func (e *Engine) triggerStops() {
+	var triggered []stopOrder
+	for {
+		if e.phase != Continuous {
+			// Trading was interrupted. Hold any triggered stops until it
+			// resumes, when they trigger again.
+			e.stops = append(triggered, e.stops...)
+			return
+		}
+		if e.lastPrice != 0 {
+			pending := e.stops[:0]
+			for _, stop := range e.stops {
+				if stop.order.side == Bid && e.lastPrice >= stop.opts.StopPrice ||
+					stop.order.side == Ask && e.lastPrice <= stop.opts.StopPrice {
+					triggered = append(triggered, stop)
+				} else {
+					pending = append(pending, stop)
 				}
 			}
+			e.stops = pending
 		}
 
-		e.curOrderID++
-		entry := &e.bookEntries[e.curOrderID]
-		entry.size = orderSize
-		entry.trader = order.trader
-		ppInsertOrder(&e.pricePoints[price], entry)
+		if len(triggered) == 0 {
+			return
+		}
+		stop := triggered[0]
+		triggered = triggered[1:]
 
-		if e.bidMax < uint(price) {
-			e.bidMax = uint(price)
+		entry := &e.bookEntries[stop.orderID]
+		if entry.size == 0 {
+			continue // Cancelled before it was triggered.
+		}
+		entry.size = 0
+		if !e.meetsMinimum(stop.order, &stop.opts) {
+			// Dropped, like a rejected order.
+			if e.Orders != nil {
+				e.Orders.cancel(stop.orderID, stop.order.size, OrderRejected)
+			}
+			continue
 		}
+		e.process(stop.orderID, stop.order, &stop.opts)
+	}
+}
 
-		return e.curOrderID
-	} else { // Sell order.
-		// Look for outstanding Buy orders that cross with the incoming order.
-		if uint(price) <= e.bidMax {
-			ppEntry := &e.pricePoints[e.bidMax]
+// Remove cancelled orders from the untriggered stop orders.
+func (e *Engine) dropCancelledStops() {
+	stops := e.stops[:0]
+	for _, stop := range e.stops {
+		if e.bookEntries[stop.orderID].size > 0 {
+			stops = append(stops, stop)
+		}
+	}
+	e.stops = stops
+}
 
-			for {
-				bookEntry := ppEntry.listHead
+// Match an incoming order against the orders at a single price point, in
+// time priority with displayed orders ahead of hidden ones, returning the
+// unfilled quantity. Filled and cancelled orders are unhooked from the lists
+// as we go. When the displayed slice of an iceberg order is filled, the next
+// slice is replenished from its reserve at the back of the list.
+//
+// All-or-none orders too large for the incoming order to fill are skipped,
+// as is every all-or-none order in an auction. So are orders on the incoming
+// order's own side of the book, which can only be found here when the book
+// is crossed around all-or-none orders. Also reports whether any orders on
+// the opposite side were skipped.
+//
+// Orders in the incoming order's self-trade prevention group are cancelled
+// or decremented rather than matched, according to SelfTradePrevention.
+func (e *Engine) matchPricePoint(ppEntry *pricePoint, orderID OrderID, order Order, group string, price Price, orderSize Size) (Size, bool) {
+	lists := [...]struct{ head, tail **orderBookEntry }{
+		{&ppEntry.listHead, &ppEntry.listTail},
+		{&ppEntry.hiddenHead, &ppEntry.hiddenTail},
+	}
 
-				for bookEntry != nil {
-					if bookEntry.size < orderSize {
-						execute(e.Execute, order.symbol, bookEntry.trader, order.trader, price, bookEntry.size)
+	// Neither side takes liquidity in an auction.
+	aggressor := order.side
+	if e.phase != Continuous {
+		aggressor = noAggressor
+	}
 
-						orderSize -= bookEntry.size
-						bookEntry = bookEntry.next
-					} else {
-						execute(e.Execute, order.symbol, bookEntry.trader, order.trader, price, orderSize)
+	skipped := false
+	for _, list := range lists {
+		if e.AllocationPolicy.Allocation != FIFO && e.matchAllocated(*list.head, orderID, order, group, aggressor, price, orderSize) {
+			return 0, skipped
+		}
 
-						if bookEntry.size > orderSize {
-							bookEntry.size -= orderSize
-						} else {
-							bookEntry = bookEntry.next
-						}
+		var prev *orderBookEntry
+		for bookEntry := *list.head; bookEntry != nil; {
+			if bookEntry.size > 0 {
+				if bookEntry.side == order.side || (bookEntry.size > orderSize || e.phase != Continuous) && e.attrs(bookEntry.id).aon {
+					skipped = skipped || bookEntry.side != order.side
+					prev, bookEntry = bookEntry, bookEntry.next
+					continue
+				}
 
-						ppEntry.listHead = bookEntry
-						e.curOrderID++
-						return e.curOrderID
+				if e.SelfTradePrevention != STPNone && e.group(bookEntry) == group {
+					// Either the incoming order is done, or the book entry
+					// has been cancelled and is unhooked below.
+					orderSize = e.preventSelfTrade(orderID, order, orderSize, bookEntry)
+					if orderSize == 0 {
+						return 0, skipped
+					}
+				} else {
+					fill := bookEntry.size
+					if orderSize < fill {
+						fill = orderSize
+					}
+					if order.side == Bid {
+						execute(e.Execute, e.Fees, order.symbol, order.trader, bookEntry.trader, aggressor, price, fill)
+					} else {
+						execute(e.Execute, e.Fees, order.symbol, bookEntry.trader, order.trader, aggressor, price, fill)
+					}
+					e.recordFill(orderID, bookEntry.id, price, fill)
+					e.lastPrice = price
+
+					orderSize -= fill
+					bookEntry.size -= fill
+					if bookEntry.size > 0 {
+						return 0, skipped
 					}
 				}
+			}
 
-				// We have exhausted all orders at the bidMax price point. Move
-				// on to the next price level.
-				ppEntry.listHead = nil
-				e.bidMax--
-				ppEntry = &e.pricePoints[e.bidMax]
+			if prev == nil {
+				*list.head = bookEntry.next
+			} else {
+				prev.next = bookEntry.next
+			}
+			if *list.tail == bookEntry {
+				*list.tail = prev
+			}
 
-				if uint(price) > e.bidMax {
-					break
+			if bookEntry.reserve > 0 {
+				attrs := e.attrs(bookEntry.id)
+				bookEntry.size = attrs.peak
+				if bookEntry.reserve < bookEntry.size {
+					bookEntry.size = bookEntry.reserve
 				}
+				bookEntry.reserve -= bookEntry.size
+				bookEntry.next = nil
+				ppInsertOrder(ppEntry, bookEntry, attrs.hidden)
+			}
+
+			if orderSize == 0 {
+				return 0, skipped
+			}
+			if prev == nil {
+				bookEntry = *list.head
+			} else {
+				bookEntry = prev.next
 			}
 		}
+	}
 
-		e.curOrderID++
-		entry := &e.bookEntries[e.curOrderID]
-		entry.size = orderSize
-		entry.trader = order.trader
-		ppInsertOrder(&e.pricePoints[price], entry)
+	return orderSize, skipped
+}
 
-		if e.askMin > uint(price) {
-			e.askMin = uint(price)
+// Return the unfilled quantity of an incoming order after matching it
+// against the orders at a single price point, without changing the book.
+// Also reports whether an order in the given self-trade prevention group was
+// reached, if group is not empty.
+func (e *Engine) availableAt(ppEntry *pricePoint, side Side, group string, orderSize Size) (Size, bool) {
+	for _, bookEntry := range [...]*orderBookEntry{ppEntry.listHead, ppEntry.hiddenHead} {
+		for ; bookEntry != nil; bookEntry = bookEntry.next {
+			if bookEntry.size == 0 || bookEntry.side == side || bookEntry.size > orderSize && e.attrs(bookEntry.id).aon {
+				continue
+			}
+			if group != "" && e.group(bookEntry) == group {
+				return orderSize, true
+			}
+			fill := bookEntry.size + bookEntry.reserve
+			if orderSize <= fill {
+				return 0, false
+			}
+			orderSize -= fill
 		}
+	}
+	return orderSize, false
+}
 
-		return e.curOrderID
+// Report whether an incoming order will search the opposite side of the
+// book for a match on arrival.
+func (e *Engine) crosses(order Order) bool {
+	if order.side == Bid {
+		return order.price >= e.askMin
 	}
+	return order.price <= e.bidMax
 }
 
+// Cancel an outstanding order. Unknown order IDs are ignored.
 func (e *Engine) Cancel(orderID OrderID) {
-	e.bookEntries[orderID].size = 0
+	if orderID == 0 || orderID > e.curOrderID {
+		return
+	}
+	if e.Orders != nil {
+		e.Orders.cancel(orderID, e.outstanding(orderID), OrderCancelled)
+	}
+	bookEntry := &e.bookEntries[orderID]
+	bookEntry.size = 0
+	bookEntry.reserve = 0
+	if len(e.stops) > 0 {
+		e.dropCancelledStops()
+	}
+	if len(e.pegs) > 0 {
+		e.repeg()
+	}
+	if e.phase != Continuous {
+		e.publishIndicative()
+	}
+	e.debugCheck()
+}
+
+// Return the unfilled size of an outstanding order, including an untriggered
+// stop order or the reserve of an iceberg order, or 0 if there is none.
+func (e *Engine) outstanding(orderID OrderID) Size {
+	if orderID == 0 || orderID > e.curOrderID {
+		return 0
+	}
+	entry := &e.bookEntries[orderID]
+	return entry.size + entry.reserve
+}
+
+// Return the attributes of an order, which are zero for most orders.
+func (e *Engine) attrs(orderID OrderID) orderAttributes {
+	if len(e.attributes) == 0 {
+		return orderAttributes{}
+	}
+	return e.attributes[orderID]
+}
+
+// Record the attributes of an order.
+func (e *Engine) setAttrs(orderID OrderID, attrs orderAttributes) {
+	if e.attributes == nil {
+		e.attributes = make(map[OrderID]orderAttributes)
+	}
+	e.attributes[orderID] = attrs
+}
+
+// Return the self-trade prevention group of a resting order.
+func (e *Engine) group(entry *orderBookEntry) string {
+	if group := e.attrs(entry.id).group; group != "" {
+		return group
+	}
+	return entry.trader
+}
+
+// Level is an aggregated price level in a depth snapshot.
+type Level struct {
+	Price  Price
+	Size   Size // Total outstanding size.
+	Orders int  // Number of outstanding orders.
+}
+
+// Depth returns the outstanding price levels on one side of the book, best
+// price first.
+func (e *Engine) Depth(side Side) []Level {
+	var levels []Level
+
+	if side == Bid {
+		for price, ok := e.pricePoints.prev(e.bidMax); ok && price >= minPrice; price, ok = e.pricePoints.prev(price - 1) {
+			levels = appendLevel(levels, side, price, e.pricePoints.get(price))
+		}
+	} else {
+		for price, ok := e.pricePoints.next(e.askMin); ok && price <= maxPrice; price, ok = e.pricePoints.next(price + 1) {
+			levels = appendLevel(levels, side, price, e.pricePoints.get(price))
+		}
+	}
+
+	return levels
+}
+
+// Append a price point's orders on one side of the book to a depth snapshot,
+// skipping it if it has no outstanding orders on that side.
+func appendLevel(levels []Level, side Side, price Price, ppEntry *pricePoint) []Level {
+	lvl := Level{Price: price}
+	for bookEntry := ppEntry.listHead; bookEntry != nil; bookEntry = bookEntry.next {
+		if bookEntry.size > 0 && bookEntry.side == side {
+			lvl.Size += bookEntry.size
+			lvl.Orders++
+		}
+	}
+
+	if lvl.Orders == 0 {
+		return levels
+	}
+	return append(levels, lvl)
 }
 
-// Report trade execution.
-func execute(hook func(Execution), symbol, buyTrader, sellTrader string, price Price, size Size) {
-	if hook == nil {
+// Report trade execution, charging fees if there is a fee schedule. The
+// aggressor is the side of the incoming order, which took liquidity, or
+// noAggressor for an auction trade.
+func execute(hook func(Execution), fees *FeeSchedule, symbol, buyTrader, sellTrader string, aggressor Side, price Price, size Size) {
+	if hook == nil && fees == nil {
 		return // No callback defined.
 	}
 
@@ -245,20 +926,98 @@ func execute(hook func(Execution), symbol, buyTrader, sellTrader string, price P
 
 	exec.side = Bid
 	exec.trader = buyTrader
-
-	hook(exec) // Report the buy-side trade.
+	exec.liquidity = liquidity(Bid, aggressor)
+	if fees != nil {
+		fees.charge(&exec)
+	}
+	if hook != nil {
+		hook(exec) // Report the buy-side trade.
+	}
 
 	exec.side = Ask
 	exec.trader = sellTrader
-	hook(exec) // Report the sell-side trade.
+	exec.liquidity = liquidity(Ask, aggressor)
+	if fees != nil {
+		fees.charge(&exec)
+	}
+	if hook != nil {
+		hook(exec) // Report the sell-side trade.
+	}
+}
+
+// Record a fill of both orders in an execution, if there is an order store.
+func (e *Engine) recordFill(orderID, contraID OrderID, price Price, size Size) {
+	if e.Orders != nil {
+		e.Orders.fill(orderID, price, size)
+		e.Orders.fill(contraID, price, size)
+	}
 }
 
-// Insert a new order book entry at the tail of the price point list.
-func ppInsertOrder(ppEntry *pricePoint, entry *orderBookEntry) {
-	if ppEntry.listHead != nil {
-		ppEntry.listTail.next = entry
+const noAggressor Side = -1
+
+func liquidity(side, aggressor Side) Liquidity {
+	if aggressor == noAggressor {
+		return Auction
+	}
+	if side == aggressor {
+		return Taker
+	}
+	return Maker
+}
+
+// Insert a new order book entry at the tail of the price point's displayed
+// or hidden list.
+func ppInsertOrder(ppEntry *pricePoint, entry *orderBookEntry, hidden bool) {
+	listHead, listTail := &ppEntry.listHead, &ppEntry.listTail
+	if hidden {
+		listHead, listTail = &ppEntry.hiddenHead, &ppEntry.hiddenTail
+	}
+
+	if *listHead != nil {
+		(*listTail).next = entry
 	} else {
-		ppEntry.listHead = entry
+		*listHead = entry
+	}
+	*listTail = entry
+}
+
+// Unhook an order book entry from whichever of the price point's displayed
+// and hidden lists it is queued in.
+func ppRemoveOrder(ppEntry *pricePoint, entry *orderBookEntry) {
+	lists := [...]struct{ head, tail **orderBookEntry }{
+		{&ppEntry.listHead, &ppEntry.listTail},
+		{&ppEntry.hiddenHead, &ppEntry.hiddenTail},
+	}
+
+	for _, list := range lists {
+		var prev *orderBookEntry
+		for bookEntry := *list.head; bookEntry != nil; prev, bookEntry = bookEntry, bookEntry.next {
+			if bookEntry != entry {
+				continue
+			}
+			if prev == nil {
+				*list.head = entry.next
+			} else {
+				prev.next = entry.next
+			}
+			if *list.tail == entry {
+				*list.tail = prev
+			}
+			entry.next = nil
+			return
+		}
+	}
+}
+
+// Report whether a price point holds any outstanding orders on one side of
+// the book.
+func (ppEntry *pricePoint) live(side Side) bool {
+	for _, bookEntry := range [...]*orderBookEntry{ppEntry.listHead, ppEntry.hiddenHead} {
+		for ; bookEntry != nil; bookEntry = bookEntry.next {
+			if bookEntry.size > 0 && bookEntry.side == side {
+				return true
+			}
+		}
 	}
-	ppEntry.listTail = entry
+	return false
 }
@@ -24,13 +24,14 @@ var (
 	ob101x25  = Order{"JPM", "MAX", Bid, 101, 25}
 	ob101x25x = Order{"JPM", "XAM", Bid, 101, 25}
 
-	xa101x100 = Execution{"JPM", "MAX", Ask, 101, 100}
-	xb101x100 = Execution{"JPM", "MAX", Bid, 101, 100}
-	xa101x50  = Execution{"JPM", "MAX", Ask, 101, 50}
-	xb101x50  = Execution{"JPM", "MAX", Bid, 101, 50}
-	xa101x25  = Execution{"JPM", "MAX", Ask, 101, 25}
-	xb101x25  = Execution{"JPM", "MAX", Bid, 101, 25}
-	xb101x25x = Execution{"JPM", "XAM", Bid, 101, 25}
+	// Liquidity and fees are not compared by runTest.
+	xa101x100 = Execution{"JPM", "MAX", Ask, 101, 100, 0, 0}
+	xb101x100 = Execution{"JPM", "MAX", Bid, 101, 100, 0, 0}
+	xa101x50  = Execution{"JPM", "MAX", Ask, 101, 50, 0, 0}
+	xb101x50  = Execution{"JPM", "MAX", Bid, 101, 50, 0, 0}
+	xa101x25  = Execution{"JPM", "MAX", Ask, 101, 25, 0, 0}
+	xb101x25  = Execution{"JPM", "MAX", Bid, 101, 25, 0, 0}
+	xb101x25x = Execution{"JPM", "XAM", Bid, 101, 25, 0, 0}
 )
 
 func TestAsk(t *testing.T) {
@@ -89,20 +90,44 @@ func TestCancelFrontBackOutOfOrderThenPartialExecution(t *testing.T) {
 	runTest(t, &Test{Orders: []Order{ob101x100, ob101x25x, ob101x25x, ob101x50}, Cancels: []OrderID{1, 4, 3}, Orders2: []Order{oa101x50}, Expected: []Execution{xb101x25x, xa101x25}})
 }
 
+func TestPriceAboveRangeIgnored(t *testing.T) {
+	for _, impl := range matchingEngines {
+		t.Run(impl.name, func(t *testing.T) {
+			var executions []Execution
+			e := impl.new()
+			e.Reset()
+			e.SetExecute(func(x Execution) { executions = append(executions, x) })
+
+			assert.Equal(t, OrderID(0), e.Limit(Order{"JPM", "MAX", Bid, maxPrice + 1, 100}))
+			assert.Equal(t, OrderID(0), e.Limit(Order{"JPM", "MAX", Bid, ^Price(0), 100}))
+			assert.Equal(t, OrderID(1), e.Limit(oa101x100))
+			assert.Empty(t, executions)
+		})
+	}
+}
+
+// Run a test against every matching engine design.
 func runTest(t *testing.T, test *Test) {
+	for _, impl := range matchingEngines {
+		t.Run(impl.name, func(t *testing.T) {
+			runTestOn(t, impl.new(), test)
+		})
+	}
+}
+
+func runTestOn(t *testing.T, e MatchingEngine, test *Test) {
 	var executions []Execution
-	var e Engine
 	e.Reset()
 
-	e.Execute = func(e Execution) {
+	e.SetExecute(func(e Execution) {
 		t.Logf("<- received execution: %v", &e)
 		executions = append(executions, e)
 		assert.False(t, len(executions) > maxExecutionCount, "too many executions, test array overflow")
-	}
+	})
 
-	curOrderID := feedOrders(t, &e, 0, &test.Orders)
-	feedCancels(t, &e, &test.Cancels)
-	feedOrders(t, &e, curOrderID, &test.Orders2)
+	curOrderID := feedOrders(t, e, 0, &test.Orders)
+	feedCancels(t, e, &test.Cancels)
+	feedOrders(t, e, curOrderID, &test.Orders2)
 
 	assert.Equal(t, len(test.Expected), len(executions), "incorrect number of executions")
 
@@ -126,7 +151,7 @@ func runTest(t *testing.T, test *Test) {
 	}
 }
 
-func feedOrders(t *testing.T, e *Engine, curOrderID OrderID, orders *[]Order) OrderID {
+func feedOrders(t *testing.T, e MatchingEngine, curOrderID OrderID, orders *[]Order) OrderID {
 	if orders != nil {
 		for i, order := range *orders {
 			id := e.Limit(order)
@@ -139,7 +164,7 @@ func feedOrders(t *testing.T, e *Engine, curOrderID OrderID, orders *[]Order) Or
 	return curOrderID
 }
 
-func feedCancels(t *testing.T, e *Engine, cancels *[]OrderID) {
+func feedCancels(t *testing.T, e MatchingEngine, cancels *[]OrderID) {
 	if cancels != nil {
 		for _, orderID := range *cancels {
 			e.Cancel(orderID)
@@ -155,3 +180,519 @@ func compare(a, b *Execution) bool {
 		a.price == b.price &&
 		a.size == b.size
 }
+
+// Replay the score feed through every matching engine design and check that
+// they all report the same executions.
+func TestEnginesAgreeOnScoreFeed(t *testing.T) {
+	var reference []Execution
+	for i, impl := range matchingEngines {
+		var executions []Execution
+		e := impl.new()
+		e.Reset()
+		e.SetExecute(func(x Execution) { executions = append(executions, x) })
+		feed(e, ordersFeed)
+
+		if i == 0 {
+			reference = executions
+			assert.NotEmpty(t, reference)
+			continue
+		}
+		assert.Equal(t, reference, executions, "%v disagrees with %v", impl.name, matchingEngines[0].name)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	var e Engine
+	e.Reset()
+	assert.NoError(t, e.Check())
+
+	e.Limit(ob101x25)
+	e.Limit(ob101x25x)
+	e.Limit(oa101x100)
+	e.Limit(Order{"JPM", "MAX", Ask, 103, 100})
+	e.Cancel(4)
+	assert.NoError(t, e.Check())
+
+	// Crossed book, which is only allowed around all-or-none orders.
+	bidMax := e.bidMax
+	crossing := &e.bookEntries[99]
+	*crossing = orderBookEntry{size: 10, id: 99, side: Bid}
+	ppInsertOrder(e.pricePoints.at(101), crossing, false)
+	e.bidMax = 101
+	assert.EqualError(t, e.Check(), "price level 101: book crossed by orders that are not all-or-none, best bid 101")
+	e.setAttrs(99, orderAttributes{aon: true})
+	assert.NoError(t, e.Check())
+	crossing.size = 0
+	e.bidMax = bidMax
+
+	// Outstanding order outside [askMin..] on the ask side.
+	e.askMin = 102
+	assert.EqualError(t, e.Check(), "price level 101: outstanding Sell orders below askMin 102")
+	e.askMin = 101
+	e.Limit(Order{"JPM", "MAX", Ask, 105, 100})
+
+	// Tail not at the end of the list.
+	pp := e.pricePoints.get(105)
+	ppInsertOrder(pp, &e.bookEntries[100], false)
+	pp.listTail = pp.listHead
+	assert.EqualError(t, e.Check(), "price level 105: list tail is not the last entry in the list")
+
+	// Cycle.
+	pp.listTail = &e.bookEntries[100]
+	pp.listTail.next = pp.listHead
+	assert.EqualError(t, e.Check(), "price level 105: cycle in order list")
+
+	// Entry shared between levels.
+	pp.listTail.next = nil
+	pp.listTail = pp.listHead
+	pp.listHead.next = nil
+	ppInsertOrder(e.pricePoints.at(106), pp.listHead, false)
+	assert.EqualError(t, e.Check(), "price level 106: order book entry also reachable from price level 105")
+}
+
+// Record the executions reported by an engine.
+func recordExecutions(e MatchingEngine) *[]Execution {
+	executions := new([]Execution)
+	e.SetExecute(func(x Execution) { *executions = append(*executions, x) })
+	return executions
+}
+
+func TestIcebergReplenishesAtBackOfQueue(t *testing.T) {
+	var e Engine
+	e.Reset()
+	executions := recordExecutions(&e)
+
+	id, err := e.Submit(oa101x100, OrderOptions{DisplaySize: 25})
+	assert.NoError(t, err)
+	assert.Equal(t, OrderID(1), id)
+	assert.Equal(t, []Level{{101, 25, 1}}, e.Depth(Ask))
+
+	e.Limit(Order{"JPM", "XAM", Ask, 101, 25})
+	assert.Equal(t, []Level{{101, 50, 2}}, e.Depth(Ask))
+
+	// The first slice trades, and the replenished slice queues behind XAM.
+	e.Limit(Order{"JPM", "BUY", Bid, 101, 50})
+	assert.Equal(t, []Execution{
+		{"JPM", "BUY", Bid, 101, 25, Taker, 0}, {"JPM", "MAX", Ask, 101, 25, Maker, 0},
+		{"JPM", "BUY", Bid, 101, 25, Taker, 0}, {"JPM", "XAM", Ask, 101, 25, Maker, 0},
+	}, *executions)
+	assert.Equal(t, []Level{{101, 25, 1}}, e.Depth(Ask))
+
+	// Sweep the remaining slices; the rest of the Buy order rests.
+	*executions = nil
+	e.Limit(Order{"JPM", "BUY", Bid, 101, 100})
+	assert.Equal(t, []Execution{
+		{"JPM", "BUY", Bid, 101, 25, Taker, 0}, {"JPM", "MAX", Ask, 101, 25, Maker, 0},
+		{"JPM", "BUY", Bid, 101, 25, Taker, 0}, {"JPM", "MAX", Ask, 101, 25, Maker, 0},
+		{"JPM", "BUY", Bid, 101, 25, Taker, 0}, {"JPM", "MAX", Ask, 101, 25, Maker, 0},
+	}, *executions)
+	assert.Empty(t, e.Depth(Ask))
+	assert.Equal(t, []Level{{101, 25, 1}}, e.Depth(Bid))
+}
+
+func TestIcebergAggressorRestsDisplayedSlice(t *testing.T) {
+	var e Engine
+	e.Reset()
+	executions := recordExecutions(&e)
+
+	e.Limit(Order{"JPM", "XAM", Ask, 101, 30})
+	_, err := e.Submit(ob101x100, OrderOptions{DisplaySize: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, []Execution{{"JPM", "MAX", Bid, 101, 30, Taker, 0}, {"JPM", "XAM", Ask, 101, 30, Maker, 0}}, *executions)
+	assert.Equal(t, []Level{{101, 10, 1}}, e.Depth(Bid))
+
+	// Cancelling removes the reserve too.
+	e.Cancel(2)
+	*executions = nil
+	e.Limit(oa101x100)
+	assert.Empty(t, *executions)
+	assert.Empty(t, e.Depth(Bid))
+}
+
+func TestSubmitRejectsInvalidPrice(t *testing.T) {
+	var e Engine
+	e.Reset()
+
+	id, err := e.Submit(Order{"JPM", "MAX", Bid, 0, 100}, OrderOptions{})
+	assert.Equal(t, OrderID(0), id)
+	assert.EqualError(t, err, "order rejected: invalid price")
+
+	for _, price := range []Price{maxPrice + 1, ^Price(0)} {
+		id, err = e.Submit(Order{"JPM", "MAX", Ask, price, 100}, OrderOptions{})
+		assert.Equal(t, OrderID(0), id)
+		assert.EqualError(t, err, "order rejected: invalid price")
+
+		id, err = e.Submit(Order{"JPM", "MAX", Bid, 101, 100}, OrderOptions{StopPrice: price})
+		assert.Equal(t, OrderID(0), id)
+		assert.EqualError(t, err, "order rejected: invalid price: stop price")
+	}
+	assert.Empty(t, e.Depth(Ask))
+	assert.Equal(t, OrderID(1), e.Limit(ob101x100))
+}
+
+func TestStopMarketTriggersOnLastTrade(t *testing.T) {
+	var e Engine
+	e.Reset()
+	executions := recordExecutions(&e)
+
+	e.Limit(Order{"JPM", "XAM", Ask, 101, 50})
+	e.Limit(Order{"JPM", "XAM", Ask, 102, 50})
+	id, err := e.Submit(Order{"JPM", "MAX", Bid, 0, 50}, OrderOptions{Market: true, StopPrice: 101})
+	assert.NoError(t, err)
+	assert.Equal(t, OrderID(3), id)
+	assert.Empty(t, *executions)
+	assert.Empty(t, e.Depth(Bid))
+
+	// A trade at the stop price releases the stop, which sweeps the book at
+	// the prices of the orders it matches.
+	e.Limit(Order{"JPM", "BUY", Bid, 101, 25})
+	assert.Equal(t, []Execution{
+		{"JPM", "BUY", Bid, 101, 25, Taker, 0}, {"JPM", "XAM", Ask, 101, 25, Maker, 0},
+		{"JPM", "MAX", Bid, 101, 25, Taker, 0}, {"JPM", "XAM", Ask, 101, 25, Maker, 0},
+		{"JPM", "MAX", Bid, 102, 25, Taker, 0}, {"JPM", "XAM", Ask, 102, 25, Maker, 0},
+	}, *executions)
+	assert.Equal(t, []Level{{102, 25, 1}}, e.Depth(Ask))
+	assert.Empty(t, e.Depth(Bid))
+}
+
+func TestStopCascade(t *testing.T) {
+	var e Engine
+	e.Reset()
+	executions := recordExecutions(&e)
+
+	e.Limit(Order{"JPM", "A", Bid, 100, 10})
+	e.Limit(Order{"JPM", "A", Bid, 99, 10})
+	e.Limit(Order{"JPM", "A", Bid, 98, 10})
+	e.Submit(Order{"JPM", "S1", Ask, 0, 10}, OrderOptions{Market: true, StopPrice: 99})
+	e.Submit(Order{"JPM", "S2", Ask, 98, 10}, OrderOptions{StopPrice: 100})
+
+	// The trade at 100 releases the stop-limit S2, whose trade at 98 in turn
+	// releases the stop-market S1.
+	e.Limit(Order{"JPM", "X", Ask, 100, 10})
+	assert.Equal(t, []Execution{
+		{"JPM", "A", Bid, 100, 10, Maker, 0}, {"JPM", "X", Ask, 100, 10, Taker, 0},
+		{"JPM", "A", Bid, 98, 10, Maker, 0}, {"JPM", "S2", Ask, 98, 10, Taker, 0},
+		{"JPM", "A", Bid, 98, 10, Maker, 0}, {"JPM", "S1", Ask, 98, 10, Taker, 0},
+	}, *executions)
+	assert.Empty(t, e.Depth(Bid))
+}
+
+func TestStopsTriggeredTogetherReleaseInTimePriority(t *testing.T) {
+	var e Engine
+	e.Reset()
+	executions := recordExecutions(&e)
+
+	e.Limit(Order{"JPM", "XAM", Ask, 101, 100})
+	e.Submit(Order{"JPM", "B1", Bid, 101, 10}, OrderOptions{StopPrice: 101})
+	e.Submit(Order{"JPM", "B2", Bid, 101, 10}, OrderOptions{StopPrice: 100})
+	cancelled, _ := e.Submit(Order{"JPM", "B3", Bid, 101, 10}, OrderOptions{StopPrice: 100})
+	e.Cancel(cancelled)
+
+	e.Limit(Order{"JPM", "MAX", Bid, 101, 10})
+	assert.Equal(t, []Execution{
+		{"JPM", "MAX", Bid, 101, 10, Taker, 0}, {"JPM", "XAM", Ask, 101, 10, Maker, 0},
+		{"JPM", "B1", Bid, 101, 10, Taker, 0}, {"JPM", "XAM", Ask, 101, 10, Maker, 0},
+		{"JPM", "B2", Bid, 101, 10, Taker, 0}, {"JPM", "XAM", Ask, 101, 10, Maker, 0},
+	}, *executions)
+	assert.Equal(t, []Level{{101, 70, 1}}, e.Depth(Ask))
+}
+
+func TestCancelledStopsAreDropped(t *testing.T) {
+	var e Engine
+	e.Reset()
+
+	for i := 0; i < 1000; i++ {
+		id, err := e.Submit(Order{"JPM", "MAX", Bid, 101, 10}, OrderOptions{StopPrice: 101})
+		assert.NoError(t, err)
+		e.Cancel(id)
+	}
+	assert.Empty(t, e.stops)
+
+	e.Submit(Order{"JPM", "MAX", Bid, 101, 10}, OrderOptions{StopPrice: 101})
+	e.Submit(Order{"JPM", "XAM", Ask, 99, 10}, OrderOptions{StopPrice: 99})
+	e.MassCancel(CancelFilter{Trader: "MAX"})
+	assert.Len(t, e.stops, 1)
+	assert.NoError(t, e.Check())
+}
+
+func TestPostOnly(t *testing.T) {
+	var e Engine
+	e.Reset()
+	executions := recordExecutions(&e)
+
+	e.Limit(oa101x100)
+	e.Cancel(e.Limit(Order{"JPM", "XAM", Bid, 99, 100})) // Leaves bidMax stale.
+
+	_, err := e.Submit(ob101x50, OrderOptions{PostOnly: PostOnlyReject})
+	assert.Equal(t, &RejectError{Reason: RejectWouldCross}, err)
+
+	_, err = e.Submit(Order{"JPM", "MAX", Bid, 100, 50}, OrderOptions{PostOnly: PostOnlyReject})
+	assert.NoError(t, err)
+
+	_, err = e.Submit(Order{"JPM", "MAX", Bid, 105, 50}, OrderOptions{PostOnly: PostOnlySlide})
+	assert.NoError(t, err)
+	assert.Equal(t, []Level{{100, 100, 2}}, e.Depth(Bid))
+
+	// A Sell slides above the best outstanding Buy order.
+	_, err = e.Submit(Order{"JPM", "MAX", Ask, 90, 50}, OrderOptions{PostOnly: PostOnlySlide})
+	assert.NoError(t, err)
+	assert.Equal(t, []Level{{101, 150, 2}}, e.Depth(Ask))
+
+	_, err = e.Submit(ob101x50, OrderOptions{PostOnly: PostOnlyReject, Market: true})
+	assert.Equal(t, RejectInvalidOptions, err.(*RejectError).Reason)
+
+	assert.Empty(t, *executions)
+}
+
+func TestHiddenOrdersQueueBehindDisplayed(t *testing.T) {
+	var e Engine
+	e.Reset()
+	executions := recordExecutions(&e)
+
+	_, err := e.Submit(Order{"JPM", "HID", Ask, 101, 50}, OrderOptions{Hidden: true})
+	assert.NoError(t, err)
+	e.Limit(oa101x25)
+	assert.Equal(t, []Level{{101, 25, 1}}, e.Depth(Ask))
+
+	e.Limit(Order{"JPM", "BUY", Bid, 101, 50})
+	assert.Equal(t, []Execution{
+		{"JPM", "BUY", Bid, 101, 25, Taker, 0}, {"JPM", "MAX", Ask, 101, 25, Maker, 0},
+		{"JPM", "BUY", Bid, 101, 25, Taker, 0}, {"JPM", "HID", Ask, 101, 25, Maker, 0},
+	}, *executions)
+	assert.Empty(t, e.Depth(Ask))
+
+	// The hidden remainder still blocks a post-only order from crossing.
+	_, err = e.Submit(ob101x25, OrderOptions{PostOnly: PostOnlyReject})
+	assert.Equal(t, RejectWouldCross, err.(*RejectError).Reason)
+}
+
+func TestPeggedOrdersReprice(t *testing.T) {
+	var e Engine
+	e.Reset()
+	executions := recordExecutions(&e)
+	var events []MarketDataEvent
+	e.MarketData = func(event MarketDataEvent) { events = append(events, event) }
+
+	e.Limit(Order{"JPM", "A", Bid, 100, 10})
+	e.Limit(Order{"JPM", "B", Ask, 104, 10})
+
+	primary, err := e.Submit(Order{"JPM", "P", Bid, 0, 10}, OrderOptions{Peg: PegPrimary})
+	assert.NoError(t, err)
+	mid, err := e.Submit(Order{"JPM", "M", Ask, 0, 10}, OrderOptions{Peg: PegMidpoint})
+	assert.NoError(t, err)
+	capped, err := e.Submit(Order{"JPM", "C", Bid, 100, 10}, OrderOptions{Peg: PegMarket, PegOffset: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, []Level{{100, 30, 3}}, e.Depth(Bid))
+	assert.Equal(t, []Level{{102, 10, 1}, {104, 10, 1}}, e.Depth(Ask))
+	assert.Empty(t, events)
+
+	// A better Buy order moves the primary and midpoint pegs; the market peg
+	// is held at its limit price.
+	e.Limit(Order{"JPM", "D", Bid, 101, 10})
+	assert.Equal(t, []MarketDataEvent{
+		{EventRepriced, primary, Bid, 101, 100, 10, 0, 0},
+		{EventRepriced, mid, Ask, 103, 102, 10, 0, 0},
+	}, events)
+	assert.Equal(t, []Level{{101, 20, 2}, {100, 20, 2}}, e.Depth(Bid))
+	assert.Equal(t, []Level{{103, 10, 1}, {104, 10, 1}}, e.Depth(Ask))
+
+	// The repriced peg lost time priority to D. Once D has traded, the pegs
+	// follow the best Buy order back down.
+	events = nil
+	e.Limit(Order{"JPM", "S", Ask, 101, 10})
+	assert.Equal(t, []Execution{{"JPM", "D", Bid, 101, 10, Maker, 0}, {"JPM", "S", Ask, 101, 10, Taker, 0}}, *executions)
+	assert.Equal(t, []MarketDataEvent{
+		{EventRepriced, primary, Bid, 100, 101, 10, 0, 0},
+		{EventRepriced, mid, Ask, 102, 103, 10, 0, 0},
+	}, events)
+
+	// Without a reference price, pegs stay where they are.
+	events = nil
+	e.Cancel(1)
+	e.Cancel(capped)
+	assert.Empty(t, events)
+	assert.Equal(t, []Level{{100, 10, 1}}, e.Depth(Bid))
+
+	_, err = e.Submit(Order{"JPM", "P", Ask, 0, 10}, OrderOptions{Peg: PegPrimary, StopPrice: 100})
+	assert.Equal(t, RejectInvalidOptions, err.(*RejectError).Reason)
+}
+
+func TestMinQuantity(t *testing.T) {
+	var e Engine
+	e.Reset()
+	executions := recordExecutions(&e)
+
+	e.Limit(Order{"JPM", "MAX", Ask, 101, 30})
+	e.Limit(Order{"JPM", "XAM", Ask, 102, 30})
+
+	_, err := e.Submit(Order{"JPM", "BLK", Bid, 101, 100}, OrderOptions{MinQuantity: 50})
+	assert.Equal(t, &RejectError{Reason: RejectMinQuantity}, err)
+	assert.Empty(t, *executions)
+
+	// Once filled up to its minimum quantity, the remainder rests.
+	_, err = e.Submit(Order{"JPM", "BLK", Bid, 102, 100}, OrderOptions{MinQuantity: 50})
+	assert.NoError(t, err)
+	assert.Equal(t, []Execution{
+		{"JPM", "BLK", Bid, 102, 30, Taker, 0}, {"JPM", "MAX", Ask, 102, 30, Maker, 0},
+		{"JPM", "BLK", Bid, 102, 30, Taker, 0}, {"JPM", "XAM", Ask, 102, 30, Maker, 0},
+	}, *executions)
+	assert.Equal(t, []Level{{102, 40, 1}}, e.Depth(Bid))
+
+	_, err = e.Submit(Order{"JPM", "BLK", Bid, 102, 10}, OrderOptions{MinQuantity: 20})
+	assert.Equal(t, RejectInvalidOptions, err.(*RejectError).Reason)
+}
+
+func TestAllOrNone(t *testing.T) {
+	var e Engine
+	e.Reset()
+	executions := recordExecutions(&e)
+
+	e.Submit(Order{"JPM", "BLK", Ask, 101, 50}, OrderOptions{AllOrNone: true})
+	e.Limit(Order{"JPM", "MAX", Ask, 102, 20})
+
+	// Too small to fill the all-or-none order, so it trades behind it and
+	// rests, leaving the book crossed.
+	e.Limit(Order{"JPM", "XAM", Bid, 102, 30})
+	assert.Equal(t, []Execution{{"JPM", "XAM", Bid, 102, 20, Taker, 0}, {"JPM", "MAX", Ask, 102, 20, Maker, 0}}, *executions)
+	assert.Equal(t, []Level{{102, 10, 1}}, e.Depth(Bid))
+	assert.Equal(t, []Level{{101, 50, 1}}, e.Depth(Ask))
+	assert.NoError(t, e.Check())
+
+	*executions = nil
+	e.Limit(Order{"JPM", "MAX", Bid, 101, 60})
+	assert.Equal(t, []Execution{{"JPM", "MAX", Bid, 101, 50, Taker, 0}, {"JPM", "BLK", Ask, 101, 50, Maker, 0}}, *executions)
+	assert.Equal(t, []Level{{102, 10, 1}, {101, 10, 1}}, e.Depth(Bid))
+	assert.Empty(t, e.Depth(Ask))
+
+	// An all-or-none order that can't be filled on arrival rests without
+	// trading, until an order arrives that can fill it.
+	*executions = nil
+	e.Submit(Order{"JPM", "BLK", Ask, 101, 30}, OrderOptions{AllOrNone: true})
+	assert.Empty(t, *executions)
+	assert.Equal(t, []Level{{101, 30, 1}}, e.Depth(Ask))
+
+	e.Limit(Order{"JPM", "XAM", Bid, 101, 30})
+	assert.Equal(t, []Execution{{"JPM", "XAM", Bid, 101, 30, Taker, 0}, {"JPM", "BLK", Ask, 101, 30, Maker, 0}}, *executions)
+	assert.Equal(t, []Level{{102, 10, 1}, {101, 10, 1}}, e.Depth(Bid))
+	assert.NoError(t, e.Check())
+
+	// All-or-none market orders can't rest, so are rejected unless filled.
+	_, err := e.Submit(Order{"JPM", "BLK", Ask, 0, 30}, OrderOptions{AllOrNone: true, Market: true})
+	assert.Equal(t, &RejectError{Reason: RejectMinQuantity}, err)
+	_, err = e.Submit(Order{"JPM", "BLK", Ask, 0, 20}, OrderOptions{AllOrNone: true, Market: true})
+	assert.NoError(t, err)
+	assert.Empty(t, e.Depth(Bid))
+}
+
+func TestSelfTradePrevention(t *testing.T) {
+	tests := []struct {
+		mode       STPMode
+		executions []Execution
+		cancels    []CancelReport
+		bids, asks []Level
+	}{
+		{STPNone, []Execution{
+			{"JPM", "MAX", Bid, 101, 50, Taker, 0}, {"JPM", "MAX", Ask, 101, 50, Maker, 0},
+			{"JPM", "MAX", Bid, 101, 30, Taker, 0}, {"JPM", "XAM", Ask, 101, 30, Maker, 0},
+		}, nil, nil, []Level{{101, 20, 1}}},
+		{STPCancelNewest, nil, []CancelReport{
+			{3, "MAX", Bid, 101, 80, CancelSelfTrade},
+		}, nil, []Level{{101, 100, 2}}},
+		{STPCancelOldest, []Execution{{"JPM", "MAX", Bid, 101, 50, Taker, 0}, {"JPM", "XAM", Ask, 101, 50, Maker, 0}}, []CancelReport{
+			{1, "MAX", Ask, 101, 50, CancelSelfTrade},
+		}, []Level{{101, 30, 1}}, nil},
+		{STPCancelBoth, nil, []CancelReport{
+			{1, "MAX", Ask, 101, 50, CancelSelfTrade},
+			{3, "MAX", Bid, 101, 80, CancelSelfTrade},
+		}, nil, []Level{{101, 50, 1}}},
+		{STPDecrement, []Execution{{"JPM", "MAX", Bid, 101, 30, Taker, 0}, {"JPM", "XAM", Ask, 101, 30, Maker, 0}}, []CancelReport{
+			{1, "MAX", Ask, 101, 50, CancelSelfTrade},
+			{3, "MAX", Bid, 101, 50, CancelSelfTrade},
+		}, nil, []Level{{101, 20, 1}}},
+	}
+
+	var e Engine
+	for _, test := range tests {
+		e.Reset()
+		e.SelfTradePrevention = test.mode
+		executions := recordExecutions(&e)
+		var cancels []CancelReport
+		e.Cancelled = func(r CancelReport) { cancels = append(cancels, r) }
+
+		e.Limit(Order{"JPM", "MAX", Ask, 101, 50})
+		e.Limit(Order{"JPM", "XAM", Ask, 101, 50})
+		e.Limit(Order{"JPM", "MAX", Bid, 101, 80})
+
+		assert.Equal(t, test.executions, *executions, "%v", test.mode)
+		assert.Equal(t, test.cancels, cancels, "%v", test.mode)
+		assert.Equal(t, test.bids, e.Depth(Bid), "%v", test.mode)
+		assert.Equal(t, test.asks, e.Depth(Ask), "%v", test.mode)
+	}
+}
+
+func TestSelfTradePreventionGroup(t *testing.T) {
+	var e Engine
+	e.Reset()
+	e.SelfTradePrevention = STPDecrement
+	executions := recordExecutions(&e)
+	var cancels []CancelReport
+	e.Cancelled = func(r CancelReport) { cancels = append(cancels, r) }
+
+	e.Submit(Order{"JPM", "MAX", Ask, 101, 50}, OrderOptions{STPGroup: "FIRM"})
+	e.Submit(Order{"JPM", "XAM", Bid, 101, 20}, OrderOptions{STPGroup: "FIRM"})
+
+	// The smaller incoming order is cancelled and the resting order keeps
+	// the rest of its quantity.
+	assert.Empty(t, *executions)
+	assert.Equal(t, []CancelReport{
+		{1, "MAX", Ask, 101, 20, CancelSelfTrade},
+		{2, "XAM", Bid, 101, 20, CancelSelfTrade},
+	}, cancels)
+	assert.Equal(t, []Level{{101, 30, 1}}, e.Depth(Ask))
+
+	// Orders outside the group trade as usual.
+	e.Limit(Order{"JPM", "XAM", Bid, 101, 10})
+	assert.Equal(t, []Execution{{"JPM", "XAM", Bid, 101, 10, Taker, 0}, {"JPM", "MAX", Ask, 101, 10, Maker, 0}}, *executions)
+}
+
+func TestAllocationPolicies(t *testing.T) {
+	orders := []Order{
+		{"JPM", "A", Ask, 101, 10},
+		{"JPM", "B", Ask, 101, 30},
+		{"JPM", "C", Ask, 101, 60},
+		{"JPM", "BUY", Bid, 101, 20},
+	}
+	fills := func(a, b, c Size) []Execution {
+		var executions []Execution
+		for i, size := range []Size{a, b, c} {
+			if size > 0 {
+				executions = append(executions,
+					Execution{"JPM", "BUY", Bid, 101, size, Taker, 0},
+					Execution{"JPM", string(rune('A' + i)), Ask, 101, size, Maker, 0})
+			}
+		}
+		return executions
+	}
+
+	tests := []struct {
+		name     string
+		policy   AllocationPolicy
+		expected []Execution
+		resting  int // Orders left at the price level.
+	}{
+		{"FIFO", AllocationPolicy{}, fills(10, 10, 0), 2},
+		{"ProRata", AllocationPolicy{Allocation: ProRata}, fills(2, 6, 12), 3},
+		{"ProRataTopOrder", AllocationPolicy{Allocation: ProRataTopOrder}, fills(10, 4, 6), 2},
+		{"SizeTime", AllocationPolicy{Allocation: SizeTime, TimePercent: 25}, fills(7, 4, 9), 3},
+	}
+
+	var e Engine
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e.AllocationPolicy = test.policy
+			runTestOn(t, &e, &Test{Orders: orders, Expected: test.expected})
+			assert.Equal(t, []Level{{101, 80, test.resting}}, e.Depth(Ask))
+			assert.NoError(t, e.Check())
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Feed files are CSV with one order per line:
+//
+//	symbol,trader,side,price,size,arrival
+//
+// where side is Bid or Ask and arrival is the intended arrival time in
+// nanoseconds from the start of the feed (empty if unknown).
+
+// WriteFeed writes a feed in the feed file format.
+func WriteFeed(w io.Writer, feed Feed) error {
+	cw := csv.NewWriter(w)
+	for i, order := range feed.Orders {
+		arrival := ""
+		if feed.Arrivals != nil {
+			arrival = strconv.FormatInt(int64(feed.Arrivals[i]), 10)
+		}
+		record := []string{
+			order.symbol,
+			order.trader,
+			order.side.String(),
+			strconv.FormatUint(uint64(order.price), 10),
+			strconv.FormatUint(uint64(order.size), 10),
+			arrival,
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ReadFeed reads a feed written by WriteFeed. Arrivals is nil unless every
+// line carries an arrival time.
+func ReadFeed(r io.Reader) (Feed, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = 6
+
+	var feed Feed
+	timed := true
+	for line := 1; ; line++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Feed{}, err
+		}
+
+		var order Order
+		order.symbol = record[0]
+		order.trader = record[1]
+		if order.side, err = parseSide(record[2]); err != nil {
+			return Feed{}, fmt.Errorf("feed line %d: %v", line, err)
+		}
+		price, err := strconv.ParseUint(record[3], 10, 64)
+		if err != nil {
+			return Feed{}, fmt.Errorf("feed line %d: bad price: %v", line, err)
+		}
+		order.price = Price(price)
+		size, err := strconv.ParseUint(record[4], 10, 64)
+		if err != nil {
+			return Feed{}, fmt.Errorf("feed line %d: bad size: %v", line, err)
+		}
+		order.size = Size(size)
+		feed.Orders = append(feed.Orders, order)
+
+		if record[5] == "" {
+			timed = false
+			continue
+		}
+		arrival, err := strconv.ParseInt(record[5], 10, 64)
+		if err != nil {
+			return Feed{}, fmt.Errorf("feed line %d: bad arrival: %v", line, err)
+		}
+		feed.Arrivals = append(feed.Arrivals, time.Duration(arrival))
+	}
+
+	if !timed {
+		feed.Arrivals = nil
+	}
+	return feed, nil
+}
+
+// Partition splits a feed with orders for several symbols into one feed per
+// symbol, in order of each symbol's first order, so that each symbol can be
+// replayed against its own Engine. Each cancel goes to the feed of the order
+// it cancels, with the order ID that feed's engine assigns to it; cancels of
+// unknown orders are dropped. A feed for a single symbol is returned as is.
+func (f Feed) Partition() []Feed {
+	index := make(map[string]int)
+	var symbols []string
+	for _, order := range f.Orders {
+		if _, ok := index[order.symbol]; !ok && order.price != 0 {
+			index[order.symbol] = len(symbols)
+			symbols = append(symbols, order.symbol)
+		}
+	}
+	if len(symbols) <= 1 {
+		return []Feed{f}
+	}
+
+	feeds := make([]Feed, len(symbols))
+	nextIDs := make([]OrderID, len(symbols))
+
+	// The feed and order ID of each limit order, by its order ID in f.
+	type placement struct {
+		feed    int
+		orderID OrderID
+	}
+	var placements []placement
+
+	for i, order := range f.Orders {
+		var p int
+		if order.price == 0 {
+			orderID := OrderID(order.size)
+			if orderID == 0 || orderID > OrderID(len(placements)) {
+				continue
+			}
+			p = placements[orderID-1].feed
+			order.symbol = symbols[p]
+			order.size = Size(placements[orderID-1].orderID)
+		} else {
+			p = index[order.symbol]
+			nextIDs[p]++
+			placements = append(placements, placement{p, nextIDs[p]})
+		}
+		feeds[p].Orders = append(feeds[p].Orders, order)
+		if f.Arrivals != nil {
+			feeds[p].Arrivals = append(feeds[p].Arrivals, f.Arrivals[i])
+		}
+	}
+	return feeds
+}
+
+func parseSide(s string) (Side, error) {
+	switch s {
+	case "Bid":
+		return Bid, nil
+	case "Ask":
+		return Ask, nil
+	default:
+		return Bid, fmt.Errorf("unknown side %q", s)
+	}
+}
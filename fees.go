@@ -0,0 +1,187 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// Liquidity flags whether a side of an execution added liquidity to the book
+// (the resting order) or removed it (the incoming order).
+type Liquidity int
+
+const (
+	Maker   Liquidity = iota + 1
+	Taker             // The incoming order.
+	Auction           // Traded in an auction uncross.
+)
+
+func (l Liquidity) String() string {
+	switch l {
+	case Maker:
+		return "Maker"
+	case Taker:
+		return "Taker"
+	case Auction:
+		return "Auction"
+	default:
+		return "Unknown"
+	}
+}
+
+// FeeRates are the fees charged per unit of size traded, in Price units.
+// Negative rates are rebates.
+type FeeRates struct {
+	Maker   float64
+	Taker   float64
+	Auction float64
+}
+
+// FeeTier applies its rates to traders whose traded size so far this month
+// is at least MinVolume.
+type FeeTier struct {
+	MinVolume Size
+	Rates     FeeRates
+}
+
+// FeeSchedule computes the fee on each side of an execution from volume
+// tiered rates, which depend on the symbol, the trader's tier and their
+// month-to-date volume, and accumulates daily fee statements. Set it as
+// Engine.Fees to attach fees to execution reports.
+type FeeSchedule struct {
+	clock   Clock
+	tiers   map[string][]FeeTier            // By trader tier.
+	symbols map[string]map[string][]FeeTier // By symbol, then trader tier.
+	traders map[string]string               // Trader tier by trader.
+
+	month      time.Time // Start of the month volume is counted for.
+	volume     map[string]Size
+	statements map[string]*FeeStatement
+}
+
+// FeeStatement sums one trader's fees over a day.
+type FeeStatement struct {
+	Trader        string
+	MakerVolume   Size
+	TakerVolume   Size
+	AuctionVolume Size
+	Fees          float64 // Charged.
+	Rebates       float64 // Paid out.
+}
+
+// Net returns the fees charged less the rebates paid.
+func (s *FeeStatement) Net() float64 {
+	return s.Fees - s.Rebates
+}
+
+// NewFeeSchedule returns a schedule that applies tiers to every trader and
+// symbol, until overridden. Tiers must be ordered by MinVolume. A nil clock
+// means the wall clock.
+func NewFeeSchedule(tiers []FeeTier, clock Clock) *FeeSchedule {
+	if clock == nil {
+		clock = systemClock{}
+	}
+	return &FeeSchedule{
+		clock:      clock,
+		tiers:      map[string][]FeeTier{"": tiers},
+		symbols:    make(map[string]map[string][]FeeTier),
+		traders:    make(map[string]string),
+		volume:     make(map[string]Size),
+		statements: make(map[string]*FeeStatement),
+	}
+}
+
+// SetTiers sets the rates for traders in a tier, in every symbol without
+// rates of its own. The empty tier is the default.
+func (s *FeeSchedule) SetTiers(tier string, tiers []FeeTier) {
+	s.tiers[tier] = tiers
+}
+
+// SetSymbolTiers sets the rates for traders in a tier trading a symbol.
+func (s *FeeSchedule) SetSymbolTiers(symbol, tier string, tiers []FeeTier) {
+	if s.symbols[symbol] == nil {
+		s.symbols[symbol] = make(map[string][]FeeTier)
+	}
+	s.symbols[symbol][tier] = tiers
+}
+
+// SetTraderTier places a trader in a tier.
+func (s *FeeSchedule) SetTraderTier(trader, tier string) {
+	s.traders[trader] = tier
+}
+
+// Volume returns a trader's traded size so far this month.
+func (s *FeeSchedule) Volume(trader string) Size {
+	s.rollMonth()
+	return s.volume[trader]
+}
+
+// EndOfDay returns the fee statements for every trader that traded since the
+// last call, ordered by trader, and starts a new day.
+func (s *FeeSchedule) EndOfDay() []FeeStatement {
+	statements := make([]FeeStatement, 0, len(s.statements))
+	for _, statement := range s.statements {
+		statements = append(statements, *statement)
+	}
+	sort.Slice(statements, func(i, j int) bool { return statements[i].Trader < statements[j].Trader })
+	s.statements = make(map[string]*FeeStatement)
+	return statements
+}
+
+// Compute the fee on one side of an execution, and record it and its volume.
+func (s *FeeSchedule) charge(x *Execution) {
+	s.rollMonth()
+
+	tier := s.traders[x.trader]
+	tiers, ok := s.symbols[x.symbol][tier]
+	if !ok {
+		tiers, ok = s.tiers[tier]
+	}
+	if !ok {
+		tiers = s.tiers[""]
+	}
+
+	var rates FeeRates
+	for _, t := range tiers {
+		if s.volume[x.trader] >= t.MinVolume {
+			rates = t.Rates
+		}
+	}
+	rate := rates.Taker
+	switch x.liquidity {
+	case Maker:
+		rate = rates.Maker
+	case Auction:
+		rate = rates.Auction
+	}
+	x.fee = rate * float64(x.size)
+	s.volume[x.trader] += x.size
+
+	statement, ok := s.statements[x.trader]
+	if !ok {
+		statement = &FeeStatement{Trader: x.trader}
+		s.statements[x.trader] = statement
+	}
+	switch x.liquidity {
+	case Maker:
+		statement.MakerVolume += x.size
+	case Taker:
+		statement.TakerVolume += x.size
+	default:
+		statement.AuctionVolume += x.size
+	}
+	if x.fee > 0 {
+		statement.Fees += x.fee
+	} else {
+		statement.Rebates -= x.fee
+	}
+}
+
+// Reset month-to-date volumes at the start of a new month.
+func (s *FeeSchedule) rollMonth() {
+	now := s.clock.Now()
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	if !month.Equal(s.month) {
+		s.month = month
+		s.volume = make(map[string]Size)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFeeSchedule(t *testing.T) {
+	clock := &fakeClock{time.Date(2026, time.January, 30, 16, 0, 0, 0, time.UTC)}
+	fees := NewFeeSchedule([]FeeTier{
+		{0, FeeRates{Maker: -0.125, Taker: 0.25}},
+		{100, FeeRates{Maker: -0.25, Taker: 0.125}},
+	}, clock)
+	fees.SetTiers("mm", []FeeTier{{0, FeeRates{Maker: -0.375, Taker: 0.125}}})
+	fees.SetTraderTier("MM", "mm")
+	fees.SetSymbolTiers("IBM", "", []FeeTier{{0, FeeRates{Maker: 0.5, Taker: 0.5}}})
+
+	var e Engine
+	e.Reset()
+	e.Fees = fees
+	executions := recordExecutions(&e)
+
+	e.Limit(Order{"JPM", "MAX", Ask, 101, 100})
+	e.Limit(Order{"JPM", "XAM", Bid, 101, 60})
+	assert.Equal(t, []Execution{{"JPM", "XAM", Bid, 101, 60, Taker, 15}, {"JPM", "MAX", Ask, 101, 60, Maker, -7.5}}, *executions)
+
+	// XAM reaches the next volume tier after this order.
+	e.Limit(Order{"JPM", "XAM", Bid, 101, 40})
+	e.Limit(Order{"JPM", "MM", Ask, 102, 50})
+	e.Limit(Order{"JPM", "XAM", Bid, 102, 50})
+	e.Limit(Order{"IBM", "MAX", Ask, 50, 10})
+	e.Limit(Order{"IBM", "XAM", Bid, 50, 10})
+	assert.Equal(t, []Execution{
+		{"JPM", "XAM", Bid, 101, 40, Taker, 10}, {"JPM", "MAX", Ask, 101, 40, Maker, -5},
+		{"JPM", "XAM", Bid, 102, 50, Taker, 6.25}, {"JPM", "MM", Ask, 102, 50, Maker, -18.75},
+		{"IBM", "XAM", Bid, 50, 10, Taker, 5}, {"IBM", "MAX", Ask, 50, 10, Maker, 5},
+	}, (*executions)[2:])
+
+	statements := fees.EndOfDay()
+	assert.Equal(t, []FeeStatement{
+		{"MAX", 110, 0, 0, 5, 12.5},
+		{"MM", 50, 0, 0, 0, 18.75},
+		{"XAM", 0, 160, 0, 36.25, 0},
+	}, statements)
+	assert.Equal(t, -7.5, statements[0].Net())
+	assert.Empty(t, fees.EndOfDay())
+
+	// Volume tiers start again each month.
+	assert.Equal(t, Size(160), fees.Volume("XAM"))
+	clock.Advance(3 * 24 * time.Hour)
+	assert.Equal(t, Size(0), fees.Volume("XAM"))
+}
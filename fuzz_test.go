@@ -0,0 +1,156 @@
+package main
+
+import (
+	"testing"
+)
+
+// Size in bytes of one encoded fuzz operation.
+const fuzzOpSize = 4
+
+// Maximum number of operations decoded from one fuzz input. Longer inputs are
+// truncated so that each run stays quick and the fuzzer explores breadth.
+const maxFuzzOps = 256
+
+// Decode a fuzz input into a sequence of feed operations, using the QuantCup
+// convention for cancels (zero price, order ID in the size field). At most
+// maxFuzzOps operations are decoded, each four bytes:
+//
+//	kind:  bit 0-1 select a cancel (0) or limit order, bit 2 the side.
+//	price: mostly clustered around 100 so that orders cross, with a few
+//	       values reserved for the extremes of the price range and for
+//	       prices outside it.
+//	size:  0-63.
+//	arg:   the trader of a limit order, or the order ID to cancel.
+func decodeFuzzOps(data []byte) []Order {
+	traders := [...]string{"A", "B", "C", "D"}
+
+	if len(data) > maxFuzzOps*fuzzOpSize {
+		data = data[:maxFuzzOps*fuzzOpSize]
+	}
+
+	var ops []Order
+	for ; len(data) >= fuzzOpSize; data = data[fuzzOpSize:] {
+		kind, price, size, arg := data[0], data[1], data[2], data[3]
+
+		if kind&3 == 0 {
+			id := OrderID(arg)
+			if price == 255 {
+				id = OrderID(maxNumOrders) + OrderID(arg)
+			}
+			ops = append(ops, Order{price: 0, size: Size(id)})
+			continue
+		}
+
+		order := Order{symbol: "SYM", trader: traders[arg%4], side: Side(kind >> 2 & 1), size: Size(size % 64)}
+		switch price {
+		case 255:
+			order.price = maxPrice
+		case 254:
+			order.price = maxPrice - 1
+		case 253:
+			order.price = minPrice
+		case 252:
+			order.price = 0
+		case 251:
+			order.price = maxPrice + 1
+		case 250:
+			order.price = ^Price(0)
+		default:
+			order.price = 95 + Price(price%10)
+		}
+		ops = append(ops, order)
+	}
+	return ops
+}
+
+func totalSize(levels []Level) Size {
+	var total Size
+	for _, l := range levels {
+		total += l.Size
+	}
+	return total
+}
+
+// Shared between fuzz inputs to avoid reallocating the arena. Allocated on
+// the heap so that the garbage collector paces itself on the arena's size,
+// rather than rescanning it every few allocations.
+var fuzzEngine = new(Engine)
+
+// Check that arbitrary sequences of limit orders and cancels never panic or
+// leave the book in an inconsistent state.
+func FuzzEngine(f *testing.F) {
+	f.Add([]byte{1, 0, 10, 0, 5, 0, 10, 1})                  // Simple cross.
+	f.Add([]byte{1, 0, 10, 0, 0, 0, 0, 1, 5, 0, 10, 1})      // Cancel before cross.
+	f.Add([]byte{5, 3, 20, 0, 1, 255, 5, 1, 1, 252, 5, 2})   // Extreme prices.
+	f.Add([]byte{0, 255, 0, 7, 0, 0, 0, 0, 1, 253, 0, 3})    // Bad order IDs, zero size.
+	f.Add([]byte{5, 9, 63, 0, 5, 8, 63, 1, 1, 255, 63, 2})   // Sweep to the top of the book.
+	f.Add([]byte{1, 251, 10, 0, 5, 250, 10, 1, 5, 0, 10, 2}) // Prices above the range.
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		e := fuzzEngine
+		e.Reset()
+
+		var executions []Execution
+		e.SetExecute(func(x Execution) { executions = append(executions, x) })
+
+		var lastID OrderID
+		depth := totalSize(e.Depth(Bid)) + totalSize(e.Depth(Ask))
+
+		for i, order := range decodeFuzzOps(data) {
+			executions = executions[:0]
+
+			if order.price == 0 && order.trader == "" {
+				e.Cancel(OrderID(order.size))
+			} else if id := e.Limit(order); order.price < minPrice || order.price > maxPrice {
+				if id != 0 {
+					t.Fatalf("op #%v: order with invalid price %v accepted as #%v", i, order.price, id)
+				}
+			} else {
+				if id != lastID+1 {
+					t.Fatalf("op #%v: got order ID %v, expected %v", i, id, lastID+1)
+				}
+				lastID = id
+			}
+
+			// Executions are reported in buy/sell pairs of the same size at
+			// the incoming order's price.
+			if len(executions)%2 != 0 {
+				t.Fatalf("op #%v: odd number of executions %v", i, executions)
+			}
+			var executed Size
+			for j := 0; j < len(executions); j += 2 {
+				buy, sell := executions[j], executions[j+1]
+				if buy.side != Bid || sell.side != Ask || buy.size != sell.size || buy.price != sell.price ||
+					buy.price != order.price || buy.size == 0 {
+					t.Fatalf("op #%v: mismatched execution pair %v, %v for %v", i, &buy, &sell, &order)
+				}
+				executed += buy.size
+			}
+
+			// Quantity is conserved: a limit order adds its unfilled
+			// remainder to the book and removes what it traded against; a
+			// cancel only ever removes quantity.
+			bids, asks := e.Depth(Bid), e.Depth(Ask)
+			newDepth := totalSize(bids) + totalSize(asks)
+			if order.price == 0 {
+				if len(executions) > 0 || newDepth > depth {
+					t.Fatalf("op #%v: cancel traded or added quantity", i)
+				}
+			} else if order.price >= minPrice && order.price <= maxPrice {
+				if executed > order.size || newDepth+2*executed != depth+order.size {
+					t.Fatalf("op #%v: quantity not conserved: depth %v -> %v, executed %v of %v", i, depth, newDepth, executed, &order)
+				}
+			}
+			depth = newDepth
+
+			if err := e.Check(); err != nil {
+				t.Fatalf("op #%v: %v", i, err)
+			}
+
+			// The book is never left crossed.
+			if len(bids) > 0 && len(asks) > 0 && bids[0].Price >= asks[0].Price {
+				t.Fatalf("op #%v: crossed book, best bid %v >= best ask %v", i, bids[0].Price, asks[0].Price)
+			}
+		}
+	})
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// SessionManager ties gateway sessions (FIX, binary or WebSocket
+// connections) to the orders entered through them, and cancels a session's
+// outstanding orders when it disconnects.
+//
+// A session may opt out of cancel-on-disconnect, or ask for a grace period
+// in which it can reconnect before its orders are cancelled. Grace periods
+// expire on the first call after they have elapsed, measured by the clock.
+// Order IDs are held across calls, so the engine must not be reset while
+// sessions have outstanding orders.
+type SessionManager struct {
+	*Engine
+	clock    Clock
+	sessions map[string]*gatewaySession
+}
+
+// SessionOptions configures the handling of a gateway session's orders when
+// it disconnects. The zero value cancels them immediately.
+type SessionOptions struct {
+	// Leave the session's orders in the book when it disconnects.
+	NoCancelOnDisconnect bool
+
+	// How long to wait for the session to reconnect before cancelling its
+	// orders.
+	GracePeriod time.Duration
+}
+
+type gatewaySession struct {
+	opts      SessionOptions
+	connected bool
+	deadline  time.Time // When to cancel the orders of a disconnected session.
+	orderIDs  []OrderID // Orders entered through the session.
+}
+
+// NewSessionManager returns a session manager for e. A nil clock means the
+// wall clock.
+func NewSessionManager(e *Engine, clock Clock) *SessionManager {
+	if clock == nil {
+		clock = systemClock{}
+	}
+	return &SessionManager{Engine: e, clock: clock, sessions: make(map[string]*gatewaySession)}
+}
+
+// Connect a session, or reconnect it with new options. Reconnecting within
+// the grace period keeps the session's orders.
+func (m *SessionManager) Connect(session string, opts SessionOptions) {
+	m.Poll()
+	s := m.sessions[session]
+	if s == nil {
+		s = &gatewaySession{}
+		m.sessions[session] = s
+	}
+	s.opts = opts
+	s.connected = true
+}
+
+// Disconnect a session, cancelling its outstanding orders unless it opted
+// out or has a grace period. Returns a report of each order cancelled.
+func (m *SessionManager) Disconnect(session string) []CancelReport {
+	s := m.sessions[session]
+	if s == nil || !s.connected {
+		return m.Poll()
+	}
+	s.connected = false
+	s.deadline = m.clock.Now().Add(s.opts.GracePeriod)
+	return m.Poll()
+}
+
+// Limit enters a limit order through a session. It returns 0 if the order
+// was not accepted.
+func (m *SessionManager) Limit(session string, order Order) OrderID {
+	orderID, _ := m.Submit(session, order, OrderOptions{})
+	return orderID
+}
+
+// Submit enters an order through a session, which must be connected.
+func (m *SessionManager) Submit(session string, order Order, opts OrderOptions) (OrderID, error) {
+	m.Poll()
+	s := m.sessions[session]
+	if s == nil || !s.connected {
+		return 0, &RejectError{Reason: RejectNotConnected, Detail: session}
+	}
+	orderID, err := m.Engine.Submit(order, opts)
+	if err == nil {
+		s.orderIDs = m.appendOrder(s.orderIDs, orderID)
+	}
+	return orderID, err
+}
+
+// Poll cancels the outstanding orders of disconnected sessions whose grace
+// period has elapsed, calling the Cancelled callback with a report of each.
+// Returns the reports, ordered by when each session's grace period ended.
+func (m *SessionManager) Poll() []CancelReport {
+	now := m.clock.Now()
+	var expired []*gatewaySession
+	for _, s := range m.sessions {
+		if !s.connected && !s.opts.NoCancelOnDisconnect && s.orderIDs != nil && !now.Before(s.deadline) {
+			expired = append(expired, s)
+		}
+	}
+	sort.Slice(expired, func(i, j int) bool {
+		if !expired[i].deadline.Equal(expired[j].deadline) {
+			return expired[i].deadline.Before(expired[j].deadline)
+		}
+		return expired[i].orderIDs[0] < expired[j].orderIDs[0]
+	})
+
+	var reports []CancelReport
+	for _, s := range expired {
+		reports = append(reports, m.cancelOrders(s.orderIDs, CancelDisconnect)...)
+		s.orderIDs = nil
+	}
+	return reports
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCancelOnDisconnect(t *testing.T) {
+	var e Engine
+	e.Reset()
+	var cancelled []CancelReport
+	e.Cancelled = func(report CancelReport) { cancelled = append(cancelled, report) }
+	m := NewSessionManager(&e, nil)
+
+	_, err := m.Submit("FIX1", Order{"JPM", "A", Bid, 100, 10}, OrderOptions{})
+	assert.Equal(t, RejectNotConnected, rejectReason(err))
+
+	m.Connect("FIX1", SessionOptions{})
+	m.Connect("WS1", SessionOptions{})
+	m.Limit("FIX1", Order{"JPM", "A", Bid, 100, 10})
+	m.Limit("WS1", Order{"JPM", "B", Bid, 99, 10})
+	m.Limit("FIX1", Order{"JPM", "A", Ask, 105, 10})
+	m.Limit("FIX1", Order{"JPM", "C", Ask, 106, 10}) // A session may carry several traders.
+	m.Limit("WS1", Order{"JPM", "B", Bid, 105, 4})   // Fills part of order 3.
+
+	reports := m.Disconnect("FIX1")
+	assert.Equal(t, []CancelReport{
+		{OrderID: 1, Trader: "A", Side: Bid, Price: 100, Size: 10, Reason: CancelDisconnect},
+		{OrderID: 3, Trader: "A", Side: Ask, Price: 105, Size: 6, Reason: CancelDisconnect},
+		{OrderID: 4, Trader: "C", Side: Ask, Price: 106, Size: 10, Reason: CancelDisconnect},
+	}, reports)
+	assert.Equal(t, reports, cancelled)
+	assert.Equal(t, []Level{{99, 10, 1}}, e.Depth(Bid))
+	assert.Empty(t, e.Depth(Ask))
+	assert.Empty(t, m.Disconnect("FIX1"))
+
+	_, err = m.Submit("FIX1", Order{"JPM", "A", Bid, 100, 10}, OrderOptions{})
+	assert.Equal(t, RejectNotConnected, rejectReason(err))
+	assert.NoError(t, e.Check())
+}
+
+func TestCancelOnDisconnectGracePeriod(t *testing.T) {
+	var e Engine
+	e.Reset()
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	m := NewSessionManager(&e, clock)
+
+	m.Connect("FIX1", SessionOptions{GracePeriod: time.Second})
+	m.Connect("FIX2", SessionOptions{NoCancelOnDisconnect: true})
+	m.Limit("FIX1", Order{"JPM", "A", Bid, 100, 10})
+	m.Limit("FIX2", Order{"JPM", "B", Bid, 99, 10})
+
+	// Reconnecting within the grace period keeps the session's orders.
+	assert.Empty(t, m.Disconnect("FIX1"))
+	assert.Empty(t, m.Disconnect("FIX2"))
+	clock.Advance(500 * time.Millisecond)
+	assert.Empty(t, m.Poll())
+	m.Connect("FIX1", SessionOptions{GracePeriod: time.Second})
+	clock.Advance(time.Second)
+	assert.Empty(t, m.Poll())
+
+	assert.Empty(t, m.Disconnect("FIX1"))
+	clock.Advance(time.Second)
+	assert.Equal(t, []CancelReport{
+		{OrderID: 1, Trader: "A", Side: Bid, Price: 100, Size: 10, Reason: CancelDisconnect},
+	}, m.Poll())
+
+	// Orders of sessions that opted out stay in the book, and are cancelled
+	// if the session reconnects without opting out.
+	assert.Equal(t, []Level{{99, 10, 1}}, e.Depth(Bid))
+	m.Connect("FIX2", SessionOptions{})
+	assert.Equal(t, []CancelReport{
+		{OrderID: 2, Trader: "B", Side: Bid, Price: 99, Size: 10, Reason: CancelDisconnect},
+	}, m.Disconnect("FIX2"))
+	assert.NoError(t, e.Check())
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// MarketModel describes the statistical properties of a synthetic order
+// flow. Prices are expressed in ticks of one Price unit.
+type MarketModel struct {
+	Seed int64 // Equal seeds produce identical feeds.
+
+	ArrivalRate float64 // Mean arrival rate in messages per second (Poisson).
+	CancelRatio float64 // Probability that an arrival cancels a resting order.
+
+	InitialMid    Price   // Starting point of the mid price random walk.
+	MidVolatility float64 // Standard deviation of each mid price step, in ticks.
+	PriceSpread   float64 // Mean distance of limit prices from the mid, in ticks.
+	CrossRatio    float64 // Probability that a limit order is priced through the mid.
+
+	MeanSize Size // Mean order size.
+	LotSize  Size // Order sizes are rounded up to a multiple of this.
+
+	Traders int // Number of distinct trader IDs.
+	Symbols int // Number of distinct symbols.
+}
+
+// DefaultMarketModel loosely resembles the QuantCup score feed.
+var DefaultMarketModel = MarketModel{
+	Seed:          1,
+	ArrivalRate:   100000,
+	CancelRatio:   0.4,
+	InitialMid:    4800,
+	MidVolatility: 0.5,
+	PriceSpread:   3,
+	CrossRatio:    0.1,
+	MeanSize:      500,
+	LotSize:       100,
+	Traders:       10,
+	Symbols:       1,
+}
+
+// Number of recently submitted orders that are candidates for cancellation.
+const cancelWindow int = 1000
+
+// Feed is a sequence of orders in submission order. Cancels follow the
+// QuantCup convention of a zero price with the order ID in the size field.
+// Arrivals, when present, holds the intended arrival time of each order
+// measured from the start of the feed.
+type Feed struct {
+	Orders   []Order
+	Arrivals []time.Duration
+}
+
+// Generator produces a deterministic stream of orders from a MarketModel.
+type Generator struct {
+	model   MarketModel
+	rng     *rand.Rand
+	traders []string
+	symbols []string
+
+	mid     float64       // Current mid price of the random walk.
+	clock   time.Duration // Arrival time of the last order.
+	nextID  OrderID       // ID the engine will assign to the next limit order.
+	recents []OrderID     // Live order candidates for cancellation.
+}
+
+func NewGenerator(model MarketModel) *Generator {
+	if model.Traders < 1 {
+		model.Traders = 1
+	}
+	if model.Symbols < 1 {
+		model.Symbols = 1
+	}
+	if model.LotSize == 0 {
+		model.LotSize = 1
+	}
+
+	g := &Generator{
+		model:  model,
+		rng:    rand.New(rand.NewSource(model.Seed)),
+		mid:    float64(model.InitialMid),
+		nextID: 1,
+	}
+
+	for i := 0; i < model.Traders; i++ {
+		g.traders = append(g.traders, fmt.Sprintf("ID%d", i))
+	}
+	for i := 0; i < model.Symbols; i++ {
+		if i == 0 {
+			g.symbols = append(g.symbols, "SYM")
+		} else {
+			g.symbols = append(g.symbols, fmt.Sprintf("SYM%d", i))
+		}
+	}
+
+	return g
+}
+
+// Next returns the next order in the stream along with its arrival time.
+func (g *Generator) Next() (Order, time.Duration) {
+	if g.model.ArrivalRate > 0 {
+		g.clock += time.Duration(g.rng.ExpFloat64() / g.model.ArrivalRate * float64(time.Second))
+	}
+
+	order := Order{
+		symbol: g.symbols[g.rng.Intn(len(g.symbols))],
+		trader: g.traders[g.rng.Intn(len(g.traders))],
+		side:   Side(g.rng.Intn(2)),
+	}
+
+	if len(g.recents) > 0 && g.rng.Float64() < g.model.CancelRatio {
+		i := g.rng.Intn(len(g.recents))
+		order.size = Size(g.recents[i])
+		g.recents[i] = g.recents[len(g.recents)-1]
+		g.recents = g.recents[:len(g.recents)-1]
+		return order, g.clock
+	}
+
+	g.mid += g.rng.NormFloat64() * g.model.MidVolatility
+	g.mid = math.Max(float64(minPrice)+1, math.Min(float64(maxPrice)-1, g.mid))
+
+	offset := g.rng.ExpFloat64() * g.model.PriceSpread
+	if g.rng.Float64() < g.model.CrossRatio {
+		offset = -offset
+	}
+	price := g.mid - offset
+	if order.side == Ask {
+		price = g.mid + offset
+	}
+	order.price = Price(math.Max(float64(minPrice), math.Min(float64(maxPrice), math.Round(price))))
+
+	lots := math.Ceil(g.rng.ExpFloat64() * float64(g.model.MeanSize) / float64(g.model.LotSize))
+	order.size = Size(math.Max(1, lots)) * g.model.LotSize
+
+	if len(g.recents) == cancelWindow {
+		g.recents = append(g.recents[:0], g.recents[1:]...)
+	}
+	g.recents = append(g.recents, g.nextID)
+	g.nextID++
+
+	return order, g.clock
+}
+
+// Generate returns a feed of n orders.
+func (g *Generator) Generate(n int) Feed {
+	feed := Feed{
+		Orders:   make([]Order, n),
+		Arrivals: make([]time.Duration, n),
+	}
+	for i := range feed.Orders {
+		feed.Orders[i], feed.Arrivals[i] = g.Next()
+	}
+	return feed
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGeneratorIsDeterministic(t *testing.T) {
+	feed1 := NewGenerator(DefaultMarketModel).Generate(1000)
+	feed2 := NewGenerator(DefaultMarketModel).Generate(1000)
+	assert.Equal(t, feed1, feed2)
+
+	model := DefaultMarketModel
+	model.Seed++
+	feed3 := NewGenerator(model).Generate(1000)
+	assert.NotEqual(t, feed1.Orders, feed3.Orders)
+}
+
+func TestGeneratedFeedReplays(t *testing.T) {
+	model := DefaultMarketModel
+	model.Traders = 3
+	model.Symbols = 2
+	f := NewGenerator(model).Generate(5000)
+
+	// Each symbol is replayed against its own book.
+	feeds := f.Partition()
+	assert.Len(t, feeds, 2)
+	var e Engine
+	for _, f := range feeds {
+		e.Reset()
+		var limits OrderID
+		for i, order := range f.Orders {
+			if i > 0 {
+				assert.True(t, f.Arrivals[i] >= f.Arrivals[i-1], "arrivals out of order")
+			}
+			assert.Equal(t, f.Orders[0].symbol, order.symbol)
+			if order.price == 0 {
+				assert.True(t, OrderID(order.size) <= limits, "cancel of unknown order #%v", order.size)
+				e.Cancel(OrderID(order.size))
+				continue
+			}
+			assert.True(t, order.size > 0 && order.size%model.LotSize == 0, "bad size %v", order.size)
+			limits++
+			assert.Equal(t, limits, e.Limit(order))
+		}
+	}
+}
+
+func TestFeedPartition(t *testing.T) {
+	f := Feed{Orders: []Order{
+		{"JPM", "A", Bid, 100, 10},
+		{"MSF", "B", Ask, 200, 10},
+		{"JPM", "C", Ask, 101, 10},
+		{"JPM", "D", Bid, 0, 2}, // Cancels MSF order 2, which is MSF's order 1.
+		{"MSF", "E", Bid, 0, 3}, // Cancels JPM order 3, which is JPM's order 2.
+		{"MSF", "F", Bid, 0, 9}, // Unknown order.
+	}, Arrivals: []time.Duration{1, 2, 3, 4, 5, 6}}
+
+	assert.Equal(t, []Feed{
+		{Orders: []Order{{"JPM", "A", Bid, 100, 10}, {"JPM", "C", Ask, 101, 10}, {"JPM", "E", Bid, 0, 2}},
+			Arrivals: []time.Duration{1, 3, 5}},
+		{Orders: []Order{{"MSF", "B", Ask, 200, 10}, {"MSF", "D", Bid, 0, 1}},
+			Arrivals: []time.Duration{2, 4}},
+	}, f.Partition())
+
+	single := Feed{Orders: ordersFeed[:100]}
+	assert.Equal(t, []Feed{single}, single.Partition())
+}
+
+func TestFeedFileRoundTrip(t *testing.T) {
+	f := NewGenerator(DefaultMarketModel).Generate(100)
+
+	var buf bytes.Buffer
+	assert.NoError(t, WriteFeed(&buf, f))
+	read, err := ReadFeed(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, f, read)
+
+	buf.Reset()
+	assert.NoError(t, WriteFeed(&buf, Feed{Orders: ordersFeed[:100]}))
+	read, err = ReadFeed(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, ordersFeed[:100], read.Orders)
+	assert.Nil(t, read.Arrivals)
+}
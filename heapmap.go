@@ -0,0 +1,53 @@
+package main
+
+import "container/heap"
+
+// heapMap indexes price levels by a hash map, with a binary min-heap of keys
+// to locate the best price. Deleted keys are removed from the heap lazily,
+// when they reach the top.
+type heapMap struct {
+	levels map[Price]*level
+	keys   priceHeap
+}
+
+type priceHeap []Price
+
+func (h priceHeap) Len() int            { return len(h) }
+func (h priceHeap) Less(i, j int) bool  { return h[i] < h[j] }
+func (h priceHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *priceHeap) Push(x interface{}) { *h = append(*h, x.(Price)) }
+func (h *priceHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+func newHeapMap() priceLevels {
+	return &heapMap{levels: make(map[Price]*level)}
+}
+
+func (m *heapMap) min() *level {
+	for len(m.keys) > 0 {
+		if l, ok := m.levels[m.keys[0]]; ok {
+			return l
+		}
+		heap.Pop(&m.keys)
+	}
+	return nil
+}
+
+func (m *heapMap) find(key Price) *level {
+	return m.levels[key]
+}
+
+func (m *heapMap) insert(key Price, l *level) {
+	if _, ok := m.levels[key]; !ok {
+		heap.Push(&m.keys, key)
+	}
+	m.levels[key] = l
+}
+
+func (m *heapMap) delete(key Price) {
+	delete(m.levels, key)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Instrument is the reference data for a symbol: the prices and quantities
+// its orders may use, and how its prices convert to decimal values. A Price
+// is an integer number of units of 10^-Scale, so with Scale 2 the price
+// 123.45 is 12345.
+type Instrument struct {
+	Symbol string
+	Scale  int // Decimal places in a Price.
+
+	// Prices must be a multiple of TickSize, or, if TickTable is not empty,
+	// of the tick size of the band the price falls in.
+	TickSize  Price
+	TickTable []TickBand
+
+	LotSize  Size  // Quantities must be a multiple of LotSize, if not 0.
+	MinPrice Price // Lowest valid price, if not 0.
+	MaxPrice Price // Highest valid price, if not 0.
+}
+
+// TickBand is one band of a tick table: prices from From up to the next
+// band are multiples of TickSize above From. Bands are in ascending order
+// of From.
+type TickBand struct {
+	From     Price
+	TickSize Price
+}
+
+// Tick returns the tick size at a price, 0 if any price is valid.
+func (in *Instrument) Tick(price Price) Price {
+	_, tick := in.band(price)
+	return tick
+}
+
+// Return the start and tick size of the tick band a price falls in.
+func (in *Instrument) band(price Price) (from, tick Price) {
+	tick = in.TickSize
+	for _, band := range in.TickTable {
+		if price < band.From {
+			break
+		}
+		from, tick = band.From, band.TickSize
+	}
+	return from, tick
+}
+
+// Report whether price is a valid price for the instrument.
+func (in *Instrument) onTick(price Price) bool {
+	from, tick := in.band(price)
+	return tick == 0 || (price-from)%tick == 0
+}
+
+// Return the highest price on the tick grid at or below price.
+func (in *Instrument) roundDown(price Price) Price {
+	from, tick := in.band(price)
+	if tick == 0 {
+		return price
+	}
+	return price - (price-from)%tick
+}
+
+// Return the lowest price on the tick grid at or above price, which is
+// either the next tick in price's band or the start of the next band.
+func (in *Instrument) roundUp(price Price) Price {
+	down := in.roundDown(price)
+	if down == price {
+		return price
+	}
+	up := down + in.Tick(price)
+	for _, band := range in.TickTable {
+		if band.From > price && band.From < up {
+			return band.From
+		}
+	}
+	return up
+}
+
+// Check an incoming order against the instrument's reference data. The
+// limit prices of pegged orders are optional, and their offsets must be a
+// multiple of the tick size at the limit price. The prices pegged orders
+// move to are rounded onto the tick grid (see Engine.pegPrice), since the
+// reference price may move into a band with a different tick size.
+func (in *Instrument) validate(order Order, opts *OrderOptions) error {
+	var prices []Price
+	if !opts.Market && (opts.Peg == NoPeg || order.price != 0) {
+		prices = append(prices, order.price)
+	}
+	if opts.StopPrice > 0 {
+		prices = append(prices, opts.StopPrice)
+	}
+	if tick := in.Tick(order.price); opts.Peg != NoPeg && tick != 0 && opts.PegOffset%int(tick) != 0 {
+		return &RejectError{Reason: RejectTickSize, Detail: fmt.Sprintf("peg offset %v not a multiple of %v",
+			opts.PegOffset, in.FormatPrice(tick))}
+	}
+	for _, price := range prices {
+		if in.MinPrice != 0 && price < in.MinPrice || in.MaxPrice != 0 && price > in.MaxPrice {
+			return &RejectError{Reason: RejectInvalidPrice, Detail: fmt.Sprintf("%v outside instrument price range", in.FormatPrice(price))}
+		}
+		if !in.onTick(price) {
+			return &RejectError{Reason: RejectTickSize, Detail: fmt.Sprintf("%v not a multiple of %v",
+				in.FormatPrice(price), in.FormatPrice(in.Tick(price)))}
+		}
+	}
+
+	if in.LotSize != 0 {
+		for _, size := range [...]Size{order.size, opts.DisplaySize, opts.MinQuantity} {
+			if size%in.LotSize != 0 {
+				return &RejectError{Reason: RejectLotSize, Detail: fmt.Sprintf("%v not a multiple of %v", size, in.LotSize)}
+			}
+		}
+	}
+	return nil
+}
+
+// FormatPrice returns a price as a decimal string, such as "123.45".
+func (in *Instrument) FormatPrice(price Price) string {
+	s := strconv.FormatUint(uint64(price), 10)
+	if in.Scale <= 0 {
+		return s
+	}
+	if len(s) <= in.Scale {
+		s = strings.Repeat("0", in.Scale-len(s)+1) + s
+	}
+	return s[:len(s)-in.Scale] + "." + s[len(s)-in.Scale:]
+}
+
+// ParsePrice converts a decimal string, such as "123.45", to a price. It
+// returns an error if the string has more decimal places than the
+// instrument's scale or is out of range.
+func (in *Instrument) ParsePrice(s string) (Price, error) {
+	whole, frac, _ := strings.Cut(s, ".")
+	if len(frac) > in.Scale {
+		return 0, fmt.Errorf("price %q has more than %v decimal places", s, in.Scale)
+	}
+	if whole == "" {
+		whole = "0"
+	}
+	digits := whole + frac + strings.Repeat("0", in.Scale-len(frac))
+	n, err := strconv.ParseUint(digits, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid price %q", s)
+	}
+	if n > uint64(maxPrice) {
+		return 0, fmt.Errorf("price %q out of range", s)
+	}
+	return Price(n), nil
+}
+
+// Convert a value in Price units, such as an average price or a cash amount,
+// to a decimal value.
+func (in *Instrument) decimal(value float64) float64 {
+	return value / math.Pow10(in.Scale)
+}
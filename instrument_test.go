@@ -0,0 +1,115 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstrumentValidation(t *testing.T) {
+	var e Engine
+	e.Reset()
+	e.Instrument = &Instrument{
+		Symbol:    "JPM",
+		Scale:     2,
+		TickTable: []TickBand{{From: 1, TickSize: 1}, {From: 1000, TickSize: 5}, {From: 10000, TickSize: 25}},
+		LotSize:   100,
+		MinPrice:  100,
+		MaxPrice:  50000,
+	}
+
+	assert.Equal(t, Price(1), e.Instrument.Tick(999))
+	assert.Equal(t, Price(5), e.Instrument.Tick(1000))
+	assert.Equal(t, Price(25), e.Instrument.Tick(60000))
+
+	tests := []struct {
+		order  Order
+		opts   OrderOptions
+		reason RejectReason
+	}{
+		{Order{"JPM", "A", Bid, 999, 100}, OrderOptions{}, 0},
+		{Order{"JPM", "A", Bid, 1005, 100}, OrderOptions{}, 0},
+		{Order{"JPM", "A", Bid, 1007, 100}, OrderOptions{}, RejectTickSize},
+		{Order{"JPM", "A", Bid, 10050, 100}, OrderOptions{}, 0},
+		{Order{"JPM", "A", Bid, 10055, 100}, OrderOptions{}, RejectTickSize},
+		{Order{"JPM", "A", Bid, 99, 100}, OrderOptions{}, RejectInvalidPrice},
+		{Order{"JPM", "A", Bid, 50025, 100}, OrderOptions{}, RejectInvalidPrice},
+		{Order{"JPM", "A", Bid, 500, 150}, OrderOptions{}, RejectLotSize},
+		{Order{"JPM", "A", Bid, 500, 300}, OrderOptions{DisplaySize: 50}, RejectLotSize},
+		{Order{"JPM", "A", Bid, 0, 100}, OrderOptions{Market: true}, 0},
+		{Order{"JPM", "A", Bid, 0, 100}, OrderOptions{Market: true, StopPrice: 1003}, RejectTickSize},
+	}
+	for _, test := range tests {
+		_, err := e.Submit(test.order, test.opts)
+		assert.Equal(t, test.reason, rejectReason(err), "%v %+v", test.order, test.opts)
+	}
+}
+
+func TestInstrumentTickRepricing(t *testing.T) {
+	var e Engine
+	e.Reset()
+	e.Instrument = &Instrument{Symbol: "JPM", TickSize: 5}
+
+	e.Limit(Order{"JPM", "A", Bid, 100, 10})
+	e.Limit(Order{"JPM", "B", Ask, 115, 10})
+
+	// Post-only orders slide a whole tick behind the opposite side.
+	_, err := e.Submit(Order{"JPM", "C", Bid, 115, 10}, OrderOptions{PostOnly: PostOnlySlide})
+	assert.NoError(t, err)
+	_, err = e.Submit(Order{"JPM", "C", Ask, 105, 10}, OrderOptions{PostOnly: PostOnlySlide})
+	assert.NoError(t, err)
+	assert.Equal(t, []Level{{110, 10, 1}, {100, 10, 1}}, e.Depth(Bid))
+	assert.Equal(t, []Level{{115, 20, 2}}, e.Depth(Ask))
+	_, err = e.Submit(Order{"JPM", "C", Bid, 113, 10}, OrderOptions{PostOnly: PostOnlyReject})
+	assert.Equal(t, RejectTickSize, rejectReason(err))
+
+	// Pegged prices are rounded away from the opposite side.
+	e.Reset()
+	e.Limit(Order{"JPM", "A", Bid, 100, 10})
+	e.Limit(Order{"JPM", "B", Ask, 115, 10})
+	_, err = e.Submit(Order{"JPM", "C", Bid, 0, 10}, OrderOptions{Peg: PegMidpoint})
+	assert.NoError(t, err)
+	_, err = e.Submit(Order{"JPM", "D", Ask, 0, 10}, OrderOptions{Peg: PegMidpoint})
+	assert.NoError(t, err)
+	assert.Equal(t, []Level{{105, 10, 1}, {100, 10, 1}}, e.Depth(Bid))
+	assert.Equal(t, []Level{{110, 10, 1}, {115, 10, 1}}, e.Depth(Ask))
+	_, err = e.Submit(Order{"JPM", "C", Bid, 0, 10}, OrderOptions{Peg: PegPrimary, PegOffset: 3})
+	assert.Equal(t, RejectTickSize, rejectReason(err))
+	_, err = e.Submit(Order{"JPM", "C", Bid, 103, 10}, OrderOptions{Peg: PegPrimary})
+	assert.Equal(t, RejectTickSize, rejectReason(err))
+	assert.NoError(t, e.Check())
+
+	in := &Instrument{TickTable: []TickBand{{From: 1, TickSize: 1}, {From: 1000, TickSize: 5}, {From: 10000, TickSize: 25}}}
+	assert.Equal(t, Price(999), in.roundDown(999))
+	assert.Equal(t, Price(1005), in.roundDown(1009))
+	assert.Equal(t, Price(1010), in.roundUp(1006))
+	assert.Equal(t, Price(10000), in.roundUp(9996))
+}
+
+func TestInstrumentPriceConversion(t *testing.T) {
+	in := &Instrument{Symbol: "JPM", Scale: 2}
+	assert.Equal(t, "123.45", in.FormatPrice(12345))
+	assert.Equal(t, "0.05", in.FormatPrice(5))
+
+	price, err := in.ParsePrice("123.4")
+	assert.NoError(t, err)
+	assert.Equal(t, Price(12340), price)
+	price, err = in.ParsePrice(".05")
+	assert.NoError(t, err)
+	assert.Equal(t, Price(5), price)
+	_, err = in.ParsePrice("1.234")
+	assert.Error(t, err)
+	_, err = in.ParsePrice("1,23")
+	assert.Error(t, err)
+	price, err = in.ParsePrice("1000000.01")
+	assert.NoError(t, err)
+	assert.Equal(t, Price(100000001), price)
+	_, err = in.ParsePrice("92233720368547758.07")
+	assert.Error(t, err)
+
+	in = &Instrument{Symbol: "JPM"}
+	assert.Equal(t, "12345", in.FormatPrice(12345))
+	price, err = in.ParsePrice("12345")
+	assert.NoError(t, err)
+	assert.Equal(t, Price(12345), price)
+}
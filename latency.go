@@ -0,0 +1,160 @@
+package main
+
+import (
+	"math"
+	"math/bits"
+	"time"
+)
+
+// Histogram records latencies in log-linear buckets in the style of
+// HdrHistogram: values below 2^histogramPrecision are recorded exactly and
+// larger values with a relative error of at most 2^-(histogramPrecision-1).
+type Histogram struct {
+	counts []uint64
+	count  uint64
+	min    time.Duration
+	max    time.Duration
+	sum    float64
+	sumSq  float64
+}
+
+const (
+	histogramPrecision uint = 7
+	histogramSubCount       = 1 << histogramPrecision
+	histogramHalfCount      = histogramSubCount / 2
+)
+
+func NewHistogram() *Histogram {
+	return &Histogram{counts: make([]uint64, bucketIndex(math.MaxUint64)+1)}
+}
+
+// Map a value to its bucket.
+func bucketIndex(v uint64) int {
+	if v < histogramSubCount {
+		return int(v)
+	}
+	exp := uint(bits.Len64(v)) - histogramPrecision
+	return histogramSubCount + int(exp-1)*histogramHalfCount + int(v>>exp) - histogramHalfCount
+}
+
+// Return the highest value that maps to a bucket.
+func bucketUpperBound(i int) uint64 {
+	if i < histogramSubCount {
+		return uint64(i)
+	}
+	exp := uint((i-histogramSubCount)/histogramHalfCount) + 1
+	mantissa := uint64((i-histogramSubCount)%histogramHalfCount + histogramHalfCount)
+	return (mantissa+1)<<exp - 1
+}
+
+func (h *Histogram) Record(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	h.counts[bucketIndex(uint64(d))]++
+	if h.count == 0 || d < h.min {
+		h.min = d
+	}
+	if d > h.max {
+		h.max = d
+	}
+	h.count++
+	h.sum += float64(d)
+	h.sumSq += float64(d) * float64(d)
+}
+
+func (h *Histogram) Count() uint64      { return h.count }
+func (h *Histogram) Min() time.Duration { return h.min }
+func (h *Histogram) Max() time.Duration { return h.max }
+
+func (h *Histogram) Mean() float64 {
+	if h.count == 0 {
+		return 0
+	}
+	return h.sum / float64(h.count)
+}
+
+// Sample standard deviation.
+func (h *Histogram) StdDev() float64 {
+	if h.count < 2 {
+		return 0
+	}
+	mean := h.Mean()
+	variance := (h.sumSq - float64(h.count)*mean*mean) / float64(h.count-1)
+	return math.Sqrt(math.Max(0, variance))
+}
+
+// Quantile returns the smallest recorded value (to bucket precision) that is
+// greater than or equal to a fraction q of all recorded values.
+func (h *Histogram) Quantile(q float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(q * float64(h.count)))
+	if rank < 1 {
+		rank = 1
+	}
+
+	var seen uint64
+	for i, n := range h.counts {
+		seen += n
+		if seen >= rank {
+			v := time.Duration(bucketUpperBound(i))
+			if v > h.max {
+				v = h.max
+			}
+			if v < h.min {
+				v = h.min
+			}
+			return v
+		}
+	}
+	return h.max
+}
+
+// HistogramBucket is a non-empty histogram bucket holding Count values less
+// than or equal to UpperBound nanoseconds.
+type HistogramBucket struct {
+	UpperBound int64  `json:"le"`
+	Count      uint64 `json:"count"`
+}
+
+func (h *Histogram) Buckets() []HistogramBucket {
+	var buckets []HistogramBucket
+	for i, n := range h.counts {
+		if n > 0 {
+			buckets = append(buckets, HistogramBucket{int64(bucketUpperBound(i)), n})
+		}
+	}
+	return buckets
+}
+
+// LatencySummary is the machine-readable digest of a Histogram. Durations
+// are in nanoseconds.
+type LatencySummary struct {
+	Count     uint64            `json:"count"`
+	Mean      float64           `json:"mean"`
+	StdDev    float64           `json:"stddev"`
+	Min       int64             `json:"min"`
+	P50       int64             `json:"p50"`
+	P90       int64             `json:"p90"`
+	P99       int64             `json:"p99"`
+	P999      int64             `json:"p99.9"`
+	Max       int64             `json:"max"`
+	Histogram []HistogramBucket `json:"histogram,omitempty"`
+}
+
+func (h *Histogram) Summary() LatencySummary {
+	return LatencySummary{
+		Count:     h.count,
+		Mean:      h.Mean(),
+		StdDev:    h.StdDev(),
+		Min:       int64(h.min),
+		P50:       int64(h.Quantile(0.5)),
+		P90:       int64(h.Quantile(0.9)),
+		P99:       int64(h.Quantile(0.99)),
+		P999:      int64(h.Quantile(0.999)),
+		Max:       int64(h.max),
+		Histogram: h.Buckets(),
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistogramBuckets(t *testing.T) {
+	for _, v := range []uint64{0, 1, 127, 128, 129, 1000, 123456789, math.MaxUint64} {
+		i := bucketIndex(v)
+		assert.True(t, bucketUpperBound(i) >= v, "bucket %v upper bound below %v", i, v)
+		if i > 0 {
+			assert.True(t, bucketUpperBound(i-1) < v, "value %v belongs in an earlier bucket than %v", v, i)
+		}
+	}
+}
+
+func TestHistogramQuantiles(t *testing.T) {
+	h := NewHistogram()
+	for i := 1; i <= 10000; i++ {
+		h.Record(time.Duration(i))
+	}
+
+	assert.Equal(t, uint64(10000), h.Count())
+	assert.Equal(t, time.Duration(1), h.Min())
+	assert.Equal(t, time.Duration(10000), h.Max())
+	assert.InDelta(t, 5000.5, h.Mean(), 0.001)
+
+	for _, q := range []float64{0.5, 0.9, 0.99, 0.999} {
+		expected := q * 10000
+		assert.InEpsilon(t, expected, float64(h.Quantile(q)), 1.0/histogramHalfCount, "quantile %v", q)
+	}
+	assert.Equal(t, time.Duration(10000), h.Quantile(1))
+}
@@ -1,7 +1,11 @@
 package main
 
+import "math"
+
 const (
-	maxPrice      Price  = 65535
+	// Prices fit in an int64, leaving room above maxPrice for the askMin
+	// sentinel.
+	maxPrice      Price  = math.MaxInt64 - 1
 	minPrice             = 1
 	maxLiveOrders uint16 = 65535
 )
@@ -1,7 +1,12 @@
 package main
 
 import (
+	"encoding/json"
+	"flag"
 	"fmt"
+	"log"
+	"os"
+	"runtime"
 	"time"
 
 	"github.com/grd/stat"
@@ -12,20 +17,65 @@ const (
 	replayCount     = 200
 )
 
+var (
+	feedFile   = flag.String("feed", "", "replay orders from a feed file instead of the QuantCup score feed")
+	generate   = flag.Int("generate", 0, "replay `n` orders from the synthetic market model")
+	writeFeed  = flag.String("write-feed", "", "write the feed to `file` and exit")
+	jsonOut    = flag.Bool("json", false, "print the latency report as JSON")
+	paced      = flag.Bool("paced", false, "pace per-operation measurements on the feed's arrival times")
+	rate       = flag.Float64("rate", DefaultMarketModel.ArrivalRate, "arrival rate in orders/sec for -generate, and for -paced feeds without arrival times")
+	compareAll = flag.Bool("compare", false, "compare latency and memory across the matching engine designs")
+
+	// Market model parameters for -generate.
+	seed        = flag.Int64("seed", DefaultMarketModel.Seed, "random seed for -generate")
+	cancelRatio = flag.Float64("cancel-ratio", DefaultMarketModel.CancelRatio, "probability that a generated order is a cancel")
+	mid         = flag.Uint64("mid", uint64(DefaultMarketModel.InitialMid), "starting mid price of generated orders")
+	volatility  = flag.Float64("volatility", DefaultMarketModel.MidVolatility, "standard deviation of each mid price step in ticks")
+	spread      = flag.Float64("spread", DefaultMarketModel.PriceSpread, "mean distance of generated prices from the mid in ticks")
+	crossRatio  = flag.Float64("cross-ratio", DefaultMarketModel.CrossRatio, "probability that a generated order is priced through the mid")
+	meanSize    = flag.Uint64("mean-size", uint64(DefaultMarketModel.MeanSize), "mean size of generated orders")
+	lotSize     = flag.Uint64("lot-size", uint64(DefaultMarketModel.LotSize), "generated sizes are a multiple of this")
+	traders     = flag.Int("traders", DefaultMarketModel.Traders, "number of generated trader IDs")
+	symbols     = flag.Int("symbols", DefaultMarketModel.Symbols, "number of generated symbols, each replayed against its own book")
+)
+
+// LatencyReport is the machine-readable output of a benchmark run.
+type LatencyReport struct {
+	Score      float64                   `json:"score"`
+	Batch      LatencySummary            `json:"batch"`
+	Operations map[string]LatencySummary `json:"operations"`
+	Response   *LatencySummary           `json:"response,omitempty"`
+}
+
+// Operation classes for the per-operation latency breakdown.
+type opKind int
+
+const (
+	opLimit opKind = iota // Limit order that rests without matching.
+	opCross               // Limit order that searches the book for a match.
+	opCancel
+)
+
+var opNames = [...]string{"limit", "cross", "cancel"}
+
 func main() {
-	var e Engine
+	flag.Parse()
 
-	// batch latency measurements.
-	latencies := make([]time.Duration, replayCount*(len(ordersFeed)/batchSize))
+	f, err := loadFeed()
+	if err != nil {
+		log.Fatal(err)
+	}
+	books := f.Partition()
 
-	for j := 0; j < replayCount; j++ {
-		e.Reset()
-		for i := batchSize; i < len(ordersFeed); i += batchSize {
-			begin := time.Now()
-			feed(&e, i-batchSize, i)
-			end := time.Now()
-			latencies[i/batchSize-1+(j*(len(ordersFeed)/batchSize))] = end.Sub(begin)
-		}
+	if *compareAll {
+		compareEngines(books)
+		return
+	}
+
+	var e Engine
+	var latencies []time.Duration
+	for _, book := range books {
+		latencies = append(latencies, replayBatches(&e, book.Orders)...)
 	}
 
 	data := DurationSlice(latencies)
@@ -34,19 +84,229 @@ func main() {
 	var stdDev = stat.SdMean(data, mean)
 	var score = 0.5 * (mean + stdDev)
 
+	batches := NewHistogram()
+	for _, latency := range latencies {
+		batches.Record(latency)
+	}
+
+	var service [len(opNames)]*Histogram
+	for i := range service {
+		service[i] = NewHistogram()
+	}
+	var response *Histogram
+
+	if *paced {
+		response = NewHistogram()
+		for _, book := range books {
+			arrivals := book.Arrivals
+			if arrivals == nil {
+				arrivals = make([]time.Duration, len(book.Orders))
+				for i := range arrivals {
+					arrivals[i] = time.Duration(float64(i) / *rate * float64(time.Second))
+				}
+			}
+			e.Reset()
+			measureOperations(&e, book.Orders, arrivals, &service, response)
+		}
+	} else {
+		for j := 0; j < replayCount; j++ {
+			for _, book := range books {
+				e.Reset()
+				measureOperations(&e, book.Orders, nil, &service, nil)
+			}
+		}
+	}
+
+	report := LatencyReport{
+		Score:      score,
+		Batch:      batches.Summary(),
+		Operations: make(map[string]LatencySummary),
+	}
+	for i, h := range service {
+		report.Operations[opNames[i]] = h.Summary()
+	}
+	if response != nil {
+		summary := response.Summary()
+		report.Response = &summary
+	}
+
+	if *jsonOut {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	fmt.Printf("mean(latency) = %1.2f, sd(latency) = %1.2f\n", mean, stdDev)
 	fmt.Printf("You scored %1.2f. Try to minimize this.\n", score)
+	fmt.Println()
+	printLatencyTable(report)
+}
+
+// Replay a feed replayCount times, returning the latency of each batch.
+func replayBatches(e MatchingEngine, orders []Order) []time.Duration {
+	latencies := make([]time.Duration, replayCount*(len(orders)/batchSize))
+
+	for j := 0; j < replayCount; j++ {
+		e.Reset()
+		for i := batchSize; i < len(orders); i += batchSize {
+			begin := time.Now()
+			feed(e, orders[i-batchSize:i])
+			end := time.Now()
+			latencies[i/batchSize-1+(j*(len(orders)/batchSize))] = end.Sub(begin)
+		}
+	}
+
+	return latencies
 }
 
-func feed(e *Engine, begin, end int) {
-	for i := begin; i < end; i++ {
-		var order Order = ordersFeed[i]
+// Replay the same feeds against each matching engine design and print a
+// comparison table. Retained memory is the live heap held by the engine at
+// the end of a replay; allocated memory is the total allocated during all
+// replays.
+func compareEngines(books []Feed) {
+	fmt.Printf("%-10s %10s %10s %10s %10s %10s %12s %12s\n", "engine", "score", "mean", "p50", "p99", "max", "alloc(MB)", "retained(MB)")
+
+	for _, impl := range matchingEngines {
+		var before, after runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+
+		e := impl.new()
+		var latencies []time.Duration
+		for _, book := range books {
+			latencies = append(latencies, replayBatches(e, book.Orders)...)
+		}
+
+		runtime.GC()
+		runtime.ReadMemStats(&after)
+		runtime.KeepAlive(e)
+
+		h := NewHistogram()
+		for _, latency := range latencies {
+			h.Record(latency)
+		}
+		s := h.Summary()
+		score := 0.5 * (s.Mean + s.StdDev)
+		const mb = 1 << 20
+
+		fmt.Printf("%-10s %10.2f %10.1f %10d %10d %10d %12.1f %12.1f\n", impl.name, score, s.Mean, s.P50, s.P99, s.Max,
+			float64(after.TotalAlloc-before.TotalAlloc)/mb, (float64(after.HeapAlloc)-float64(before.HeapAlloc))/mb)
+	}
+}
+
+// Replay a feed timing each operation individually. If arrivals is non-nil
+// each order is held back until its intended arrival time, and response
+// times are measured from that intended time rather than from the actual
+// submission. This keeps a stall in the engine from hiding the latency of
+// the orders queued up behind it (coordinated omission).
+func measureOperations(e *Engine, orders []Order, arrivals []time.Duration, service *[len(opNames)]*Histogram, response *Histogram) {
+	start := time.Now()
+	for i, order := range orders {
+		var intended time.Time
+		if arrivals != nil {
+			intended = start.Add(arrivals[i])
+			for time.Now().Before(intended) {
+				// Spin rather than sleep to keep timer slack out of the measurements.
+			}
+		}
+
+		kind := opLimit
 		if order.price == 0 {
-			orderID := OrderID(order.size)
-			e.Cancel(orderID)
-		} else {
-			e.Limit(order)
+			kind = opCancel
+		} else if e.crosses(order) {
+			kind = opCross
+		}
+
+		begin := time.Now()
+		process(e, order)
+		end := time.Now()
+
+		service[kind].Record(end.Sub(begin))
+		if arrivals != nil {
+			response.Record(end.Sub(intended))
+		}
+	}
+}
+
+func printLatencyTable(report LatencyReport) {
+	fmt.Printf("%-10s %10s %10s %10s %10s %10s %10s %10s\n", "(ns)", "count", "mean", "p50", "p90", "p99", "p99.9", "max")
+	row := func(name string, s LatencySummary) {
+		fmt.Printf("%-10s %10d %10.1f %10d %10d %10d %10d %10d\n", name, s.Count, s.Mean, s.P50, s.P90, s.P99, s.P999, s.Max)
+	}
+	row("batch", report.Batch)
+	for _, name := range opNames {
+		row(name, report.Operations[name])
+	}
+	if report.Response != nil {
+		row("response", *report.Response)
+	}
+}
+
+// Select the order feed according to the command line flags. Exits after
+// writing the feed if -write-feed was given.
+func loadFeed() (Feed, error) {
+	f := Feed{Orders: ordersFeed}
+
+	if *feedFile != "" {
+		r, err := os.Open(*feedFile)
+		if err != nil {
+			return Feed{}, err
+		}
+		defer r.Close()
+		if f, err = ReadFeed(r); err != nil {
+			return Feed{}, err
+		}
+	} else if *generate > 0 {
+		model := MarketModel{
+			Seed:          *seed,
+			ArrivalRate:   *rate,
+			CancelRatio:   *cancelRatio,
+			InitialMid:    Price(*mid),
+			MidVolatility: *volatility,
+			PriceSpread:   *spread,
+			CrossRatio:    *crossRatio,
+			MeanSize:      Size(*meanSize),
+			LotSize:       Size(*lotSize),
+			Traders:       *traders,
+			Symbols:       *symbols,
 		}
+		f = NewGenerator(model).Generate(*generate)
+	}
+
+	if *writeFeed != "" {
+		w, err := os.Create(*writeFeed)
+		if err != nil {
+			return Feed{}, err
+		}
+		if err := WriteFeed(w, f); err != nil {
+			w.Close()
+			return Feed{}, err
+		}
+		if err := w.Close(); err != nil {
+			return Feed{}, err
+		}
+		os.Exit(0)
+	}
+
+	return f, nil
+}
+
+func feed(e MatchingEngine, orders []Order) {
+	for _, order := range orders {
+		process(e, order)
+	}
+}
+
+// Submit a single feed entry to the engine.
+func process(e MatchingEngine, order Order) {
+	if order.price == 0 {
+		orderID := OrderID(order.size)
+		e.Cancel(orderID)
+	} else {
+		e.Limit(order)
 	}
 }
 
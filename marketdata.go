@@ -0,0 +1,49 @@
+package main
+
+import "fmt"
+
+// MarketDataType identifies the kind of a MarketDataEvent.
+type MarketDataType int
+
+const (
+	EventRepriced          MarketDataType = iota + 1 // A pegged order moved to a new price.
+	EventIndicative                                  // Indicative auction price, volume and imbalance.
+	EventStateChange                                 // The trading session changed state.
+	EventVolatilityAuction                           // An order on Side would have traded at Price, outside the price bands.
+)
+
+// MarketDataEvent describes a change to the book, published through the
+// Engine.MarketData callback. Fields that don't apply to an event type are
+// left zero.
+type MarketDataEvent struct {
+	Type      MarketDataType
+	OrderID   OrderID
+	Side      Side
+	Price     Price
+	PrevPrice Price
+	Size      Size
+	Imbalance Size // Unmatched size on Side at Price.
+	State     TradingState
+}
+
+func (t MarketDataType) String() string {
+	switch t {
+	case EventRepriced:
+		return "Repriced"
+	case EventIndicative:
+		return "Indicative"
+	case EventStateChange:
+		return "StateChange"
+	case EventVolatilityAuction:
+		return "VolatilityAuction"
+	default:
+		return fmt.Sprintf("MarketDataType(%d)", int(t))
+	}
+}
+
+// Publish a market data event.
+func (e *Engine) publish(event MarketDataEvent) {
+	if e.MarketData != nil {
+		e.MarketData(event)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+// CancelFilter selects the outstanding orders cancelled by MassCancel. Empty
+// fields match every order.
+type CancelFilter struct {
+	Trader string
+	Symbol string
+	Sides  []Side
+}
+
+// Report whether an order book entry matches the filter.
+func (f *CancelFilter) matches(entry *orderBookEntry) bool {
+	if f.Trader != "" && entry.trader != f.Trader || f.Symbol != "" && entry.symbol != f.Symbol {
+		return false
+	}
+	if len(f.Sides) == 0 {
+		return true
+	}
+	for _, side := range f.Sides {
+		if entry.side == side {
+			return true
+		}
+	}
+	return false
+}
+
+// MassCancel cancels every outstanding order matching the filter, including
+// untriggered stop orders, calling the Cancelled callback with a report of
+// each, and returns the reports in order ID order.
+//
+// Indexing every order by trader would slow down every order to speed up a
+// rare request, so the first mass cancel for a trader, and any without a
+// trader, scans every order accepted since the last Reset. From then on the
+// trader's orders are indexed as they arrive, so that traders who mass cancel
+// regularly are not held up by the scan.
+func (e *Engine) MassCancel(filter CancelFilter) []CancelReport {
+	var reports []CancelReport
+	if filter.Trader == "" {
+		for orderID := OrderID(1); orderID <= e.curOrderID; orderID++ {
+			if e.outstanding(orderID) > 0 && filter.matches(&e.bookEntries[orderID]) {
+				reports = e.cancelOrder(reports, orderID, CancelMassCancel)
+			}
+		}
+	} else {
+		// Orders submitted from the Cancelled callback are indexed in a new
+		// list, and kept after the ones that remain.
+		orderIDs := e.traderOrderIDs(filter.Trader)
+		e.traderOrders[filter.Trader] = nil
+		outstanding := orderIDs[:0]
+		for _, orderID := range orderIDs {
+			if e.outstanding(orderID) == 0 {
+				continue
+			}
+			if filter.matches(&e.bookEntries[orderID]) {
+				reports = e.cancelOrder(reports, orderID, CancelMassCancel)
+			} else {
+				outstanding = append(outstanding, orderID)
+			}
+		}
+		e.traderOrders[filter.Trader] = append(outstanding, e.traderOrders[filter.Trader]...)
+	}
+	e.dropCancelledStops()
+	e.repeg()
+	e.publishIndicative()
+	e.debugCheck()
+	return reports
+}
+
+// Return the order IDs of a trader, indexing the trader's orders from now on
+// if they are not indexed already.
+func (e *Engine) traderOrderIDs(trader string) []OrderID {
+	if orderIDs, ok := e.traderOrders[trader]; ok {
+		return orderIDs
+	}
+	if e.traderOrders == nil {
+		e.traderOrders = make(map[string][]OrderID)
+	}
+	var orderIDs []OrderID
+	for orderID := OrderID(1); orderID <= e.curOrderID; orderID++ {
+		if e.outstanding(orderID) > 0 && e.bookEntries[orderID].trader == trader {
+			orderIDs = append(orderIDs, orderID)
+		}
+	}
+	return orderIDs
+}
+
+// Index an accepted order by its trader, if the trader's orders are indexed.
+func (e *Engine) indexOrder(trader string, orderID OrderID) {
+	if orderIDs, ok := e.traderOrders[trader]; ok {
+		e.traderOrders[trader] = e.appendOrder(orderIDs, orderID)
+	}
+}
+
+// Append an order ID to a list of orders. Order IDs that are no longer
+// outstanding are dropped whenever the list fills its capacity, so that it
+// grows with the number of outstanding orders.
+func (e *Engine) appendOrder(orderIDs []OrderID, orderID OrderID) []OrderID {
+	if len(orderIDs) == cap(orderIDs) {
+		outstanding := orderIDs[:0]
+		for _, id := range orderIDs {
+			if e.outstanding(id) > 0 {
+				outstanding = append(outstanding, id)
+			}
+		}
+		orderIDs = outstanding
+	}
+	return append(orderIDs, orderID)
+}
+
+// Cancel the outstanding orders among orderIDs, calling the Cancelled
+// callback with a report of each, and return the reports.
+func (e *Engine) cancelOrders(orderIDs []OrderID, reason CancelReason) []CancelReport {
+	var reports []CancelReport
+	for _, orderID := range orderIDs {
+		reports = e.cancelOrder(reports, orderID, reason)
+	}
+	e.dropCancelledStops()
+	e.repeg()
+	e.publishIndicative()
+	e.debugCheck()
+	return reports
+}
+
+// Cancel an order on the engine's behalf, appending a report to reports
+// unless it is no longer outstanding.
+func (e *Engine) cancelOrder(reports []CancelReport, orderID OrderID, reason CancelReason) []CancelReport {
+	size := e.outstanding(orderID)
+	if size == 0 {
+		return reports
+	}
+	entry := &e.bookEntries[orderID]
+	report := CancelReport{OrderID: orderID, Trader: entry.trader, Side: entry.side, Price: entry.price,
+		Size: size, Reason: reason}
+	entry.size = 0
+	entry.reserve = 0
+	e.reportCancel(report)
+	return append(reports, report)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMassCancel(t *testing.T) {
+	var e Engine
+	e.Reset()
+	var cancelled []CancelReport
+	e.Cancelled = func(report CancelReport) { cancelled = append(cancelled, report) }
+
+	e.Limit(Order{"JPM", "A", Bid, 100, 10})
+	e.Limit(Order{"JPM", "B", Bid, 99, 10})
+	e.Limit(Order{"JPM", "A", Ask, 105, 10})
+	e.Limit(Order{"MSF", "A", Bid, 98, 10})
+	_, err := e.Submit(Order{"JPM", "A", Bid, 110, 5}, OrderOptions{StopPrice: 110})
+	assert.NoError(t, err)
+	e.Submit(Order{"JPM", "A", Ask, 106, 30}, OrderOptions{DisplaySize: 10})
+	e.Limit(Order{"JPM", "C", Bid, 105, 5}) // Fills part of order 3.
+
+	reports := e.MassCancel(CancelFilter{Trader: "A", Symbol: "JPM", Sides: []Side{Bid}})
+	assert.Equal(t, []CancelReport{
+		{OrderID: 1, Trader: "A", Side: Bid, Price: 100, Size: 10, Reason: CancelMassCancel},
+		{OrderID: 5, Trader: "A", Side: Bid, Price: 110, Size: 5, Reason: CancelMassCancel},
+	}, reports)
+	assert.Equal(t, reports, cancelled)
+
+	assert.Equal(t, []CancelReport{
+		{OrderID: 3, Trader: "A", Side: Ask, Price: 105, Size: 5, Reason: CancelMassCancel},
+		{OrderID: 4, Trader: "A", Side: Bid, Price: 98, Size: 10, Reason: CancelMassCancel},
+		{OrderID: 6, Trader: "A", Side: Ask, Price: 106, Size: 30, Reason: CancelMassCancel},
+	}, e.MassCancel(CancelFilter{Trader: "A"}))
+	assert.Empty(t, e.MassCancel(CancelFilter{Trader: "A"}))
+
+	// Without a trader, every trader's orders are cancelled.
+	assert.Equal(t, []CancelReport{
+		{OrderID: 2, Trader: "B", Side: Bid, Price: 99, Size: 10, Reason: CancelMassCancel},
+	}, e.MassCancel(CancelFilter{}))
+	assert.Empty(t, e.Depth(Bid))
+	assert.Empty(t, e.Depth(Ask))
+	assert.NoError(t, e.Check())
+}
+
+func TestMassCancelSkipsFilledOrders(t *testing.T) {
+	var e Engine
+	e.Reset()
+
+	for i := 0; i < 100; i++ {
+		e.Limit(Order{"JPM", "A", Bid, 100, 1})
+		e.Limit(Order{"JPM", "B", Ask, 100, 1})
+	}
+	id := e.Limit(Order{"JPM", "A", Bid, 100, 1})
+	assert.Equal(t, []CancelReport{
+		{OrderID: id, Trader: "A", Side: Bid, Price: 100, Size: 1, Reason: CancelMassCancel},
+	}, e.MassCancel(CancelFilter{Trader: "A"}))
+}
+
+func TestMassCancelIndexesTraderOrders(t *testing.T) {
+	var e Engine
+	e.Reset()
+
+	e.Limit(Order{"JPM", "A", Bid, 100, 10})
+	e.Limit(Order{"JPM", "B", Bid, 99, 10})
+	assert.Len(t, e.MassCancel(CancelFilter{Trader: "A"}), 1)
+	assert.Contains(t, e.traderOrders, "A")
+	assert.NotContains(t, e.traderOrders, "B")
+
+	// Orders replacing the cancelled ones from the Cancelled callback are
+	// indexed too.
+	e.Cancelled = func(report CancelReport) {
+		e.Limit(Order{"JPM", report.Trader, report.Side, report.Price - 1, report.Size})
+	}
+	e.Limit(Order{"JPM", "A", Bid, 100, 10})
+	e.Limit(Order{"JPM", "A", Ask, 105, 10})
+	assert.Equal(t, []CancelReport{
+		{OrderID: 3, Trader: "A", Side: Bid, Price: 100, Size: 10, Reason: CancelMassCancel},
+	}, e.MassCancel(CancelFilter{Trader: "A", Sides: []Side{Bid}}))
+	assert.Equal(t, []OrderID{4, 5}, e.traderOrders["A"])
+
+	e.Cancelled = nil
+	assert.Equal(t, []CancelReport{
+		{OrderID: 4, Trader: "A", Side: Ask, Price: 105, Size: 10, Reason: CancelMassCancel},
+		{OrderID: 5, Trader: "A", Side: Bid, Price: 99, Size: 10, Reason: CancelMassCancel},
+	}, e.MassCancel(CancelFilter{Trader: "A"}))
+	assert.Equal(t, []Level{{99, 10, 1}}, e.Depth(Bid))
+	assert.NoError(t, e.Check())
+}
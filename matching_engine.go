@@ -0,0 +1,202 @@
+package main
+
+// MatchingEngine is implemented by each of the limit order book designs that
+// can be benchmarked against one another. All implementations follow the same
+// price-time matching rules and order ID assignment as Engine.
+type MatchingEngine interface {
+	// Process an incoming limit order, returning its order ID.
+	Limit(order Order) OrderID
+
+	// Cancel an outstanding order.
+	Cancel(orderID OrderID)
+
+	// Clear the book and restart order IDs from 1.
+	Reset()
+
+	// Set the callback function that is called when a trade is executed.
+	SetExecute(hook func(Execution))
+}
+
+// The available matching engine designs, by name.
+var matchingEngines = []struct {
+	name string
+	new  func() MatchingEngine
+}{
+	{"array", func() MatchingEngine { return new(Engine) }},
+	{"rbtree", func() MatchingEngine { return newLevelEngine(newRBTree) }},
+	{"skiplist", func() MatchingEngine { return newLevelEngine(newSkipList) }},
+	{"heapmap", func() MatchingEngine { return newLevelEngine(newHeapMap) }},
+}
+
+func (e *Engine) SetExecute(hook func(Execution)) {
+	e.Execute = hook
+}
+
+// priceLevels is an ordered map of the price levels on one side of the book.
+// Keys are arranged so that the best price always has the smallest key (see
+// levelKey).
+type priceLevels interface {
+	min() *level
+	find(key Price) *level
+	insert(key Price, l *level)
+	delete(key Price)
+}
+
+// level: A single price level holding a FIFO queue of orders.
+type level struct {
+	side  Side
+	price Price
+	live  int // Number of orders with a non-zero size.
+	head  *levelOrder
+	tail  *levelOrder
+}
+
+// levelOrder: A single outstanding limit order.
+type levelOrder struct {
+	size   Size
+	next   *levelOrder
+	level  *level
+	trader string
+}
+
+// levelEngine is a matching engine that keeps only the populated price levels,
+// indexed by a pluggable ordered map, and allocates orders on the heap.
+type levelEngine struct {
+	execute    func(Execution)
+	newLevels  func() priceLevels
+	bids       priceLevels
+	asks       priceLevels
+	orders     []*levelOrder // Indexed by OrderID - 1.
+	curOrderID OrderID
+}
+
+func newLevelEngine(newLevels func() priceLevels) *levelEngine {
+	e := &levelEngine{newLevels: newLevels}
+	e.Reset()
+	return e
+}
+
+// Map a price to its key in the price levels of one side of the book.
+func levelKey(side Side, price Price) Price {
+	if side == Bid {
+		return maxPrice - price
+	}
+	return price
+}
+
+func (e *levelEngine) SetExecute(hook func(Execution)) {
+	e.execute = hook
+}
+
+func (e *levelEngine) Reset() {
+	e.bids = e.newLevels()
+	e.asks = e.newLevels()
+	e.orders = nil
+	e.curOrderID = 0
+}
+
+func (e *levelEngine) Limit(order Order) OrderID {
+	if order.price < minPrice || order.price > maxPrice {
+		return 0
+	}
+	e.curOrderID++
+	orderSize := order.size
+
+	book, opposite := e.bids, e.asks
+	if order.side == Ask {
+		book, opposite = e.asks, e.bids
+	}
+
+	// Look for outstanding orders on the opposite side that cross with the
+	// incoming order.
+	for l := opposite.min(); l != nil && crosses(order, l.price); l = opposite.min() {
+		for l.head != nil && orderSize > 0 {
+			entry := l.head
+			if entry.size > 0 {
+				fill := entry.size
+				if orderSize < fill {
+					fill = orderSize
+				}
+				if order.side == Bid {
+					execute(e.execute, nil, order.symbol, order.trader, entry.trader, Bid, order.price, fill)
+				} else {
+					execute(e.execute, nil, order.symbol, entry.trader, order.trader, Ask, order.price, fill)
+				}
+
+				orderSize -= fill
+				entry.size -= fill
+				if entry.size > 0 {
+					break
+				}
+				l.live--
+			}
+			l.head = entry.next
+		}
+
+		if l.live == 0 {
+			opposite.delete(levelKey(l.side, l.price))
+		}
+		if orderSize == 0 {
+			e.orders = append(e.orders, nil)
+			return e.curOrderID
+		}
+	}
+
+	// Record the remainder of the incoming order.
+	if orderSize == 0 {
+		e.orders = append(e.orders, nil)
+		return e.curOrderID
+	}
+
+	key := levelKey(order.side, order.price)
+	l := book.find(key)
+	if l == nil {
+		l = &level{side: order.side, price: order.price}
+		book.insert(key, l)
+	}
+
+	entry := &levelOrder{size: orderSize, level: l, trader: order.trader}
+	if l.head == nil {
+		l.head = entry
+	} else {
+		l.tail.next = entry
+	}
+	l.tail = entry
+	l.live++
+	e.orders = append(e.orders, entry)
+
+	return e.curOrderID
+}
+
+func (e *levelEngine) Cancel(orderID OrderID) {
+	if orderID == 0 || orderID > OrderID(len(e.orders)) {
+		return
+	}
+
+	entry := e.orders[orderID-1]
+	if entry == nil || entry.size == 0 {
+		return
+	}
+	entry.size = 0
+
+	l := entry.level
+	l.live--
+	if l.live > 0 {
+		return
+	}
+
+	book := e.bids
+	if l.side == Ask {
+		book = e.asks
+	}
+	book.delete(levelKey(l.side, l.price))
+}
+
+// Report whether an incoming order crosses with a price level on the
+// opposite side of the book.
+func crosses(order Order, price Price) bool {
+	if order.side == Bid {
+		return order.price >= price
+	}
+	return order.price <= price
+}
@@ -0,0 +1,142 @@
+package main
+
+import "time"
+
+// OrderState is the stage an order has reached in its lifecycle. Orders
+// start as OrderNew and move through OrderPartiallyFilled to one of the
+// other states. A stop order waits as OrderNew until it is triggered, and
+// goes straight to OrderRejected if it is then dropped.
+type OrderState int
+
+const (
+	OrderNew             OrderState = iota + 1 // Accepted, nothing filled yet.
+	OrderPartiallyFilled                       // Partly filled, the rest outstanding.
+	OrderFilled                                // Completely filled.
+	OrderCancelled                             // Cancelled, possibly after partial fills.
+	OrderExpired                               // Unfilled remainder of a market order discarded.
+	OrderRejected                              // Triggered stop order that could not be accepted.
+)
+
+func (s OrderState) String() string {
+	switch s {
+	case OrderNew:
+		return "New"
+	case OrderPartiallyFilled:
+		return "PartiallyFilled"
+	case OrderFilled:
+		return "Filled"
+	case OrderCancelled:
+		return "Cancelled"
+	case OrderExpired:
+		return "Expired"
+	case OrderRejected:
+		return "Rejected"
+	default:
+		return "Unknown"
+	}
+}
+
+// OrderStatus describes what has happened to an order.
+type OrderStatus struct {
+	OrderID OrderID
+	Symbol  string
+	Trader  string
+	Side    Side
+	Price   Price // 0 for a market order. Follows a pegged order as it is repriced.
+	State   OrderState
+
+	Quantity     Size    // Original quantity.
+	Remaining    Size    // Quantity still outstanding.
+	Filled       Size    // Cumulative quantity filled.
+	AveragePrice float64 // Average fill price, 0 if nothing has filled.
+
+	Created time.Time // When the order was accepted.
+	Updated time.Time // When the order last changed.
+}
+
+// OrderStore keeps the status of every order accepted by an Engine, so that
+// it can be queried by order ID. Set it as Engine.Orders to record orders.
+// Orders rejected on arrival get no order ID, so have no status; the error
+// returned by Submit says why they were rejected.
+type OrderStore struct {
+	clock  Clock
+	orders map[OrderID]*OrderStatus
+}
+
+// NewOrderStore returns an empty order store. A nil clock means the wall
+// clock.
+func NewOrderStore(clock Clock) *OrderStore {
+	if clock == nil {
+		clock = systemClock{}
+	}
+	return &OrderStore{clock: clock, orders: make(map[OrderID]*OrderStatus)}
+}
+
+// Status returns the status of an order, reporting false for an unknown
+// order ID.
+func (s *OrderStore) Status(orderID OrderID) (OrderStatus, bool) {
+	status, ok := s.orders[orderID]
+	if !ok {
+		return OrderStatus{}, false
+	}
+	return *status, true
+}
+
+// Forget every order, when the engine is reset and order IDs restart.
+func (s *OrderStore) reset() {
+	s.orders = make(map[OrderID]*OrderStatus)
+}
+
+// Record an accepted order.
+func (s *OrderStore) accept(orderID OrderID, order Order, opts *OrderOptions) {
+	now := s.clock.Now()
+	status := &OrderStatus{OrderID: orderID, Symbol: order.symbol, Trader: order.trader, Side: order.side,
+		Price: order.price, State: OrderNew, Quantity: order.size, Remaining: order.size, Created: now, Updated: now}
+	if opts.Market {
+		status.Price = 0
+	}
+	s.orders[orderID] = status
+}
+
+// Record that a pegged order has moved to a new price.
+func (s *OrderStore) reprice(orderID OrderID, price Price) {
+	status, ok := s.orders[orderID]
+	if !ok {
+		return
+	}
+	status.Price = price
+	status.Updated = s.clock.Now()
+}
+
+// Record a fill of an order.
+func (s *OrderStore) fill(orderID OrderID, price Price, size Size) {
+	status, ok := s.orders[orderID]
+	if !ok || size == 0 {
+		return
+	}
+	status.Filled += size
+	status.Remaining -= size
+	status.AveragePrice += (float64(price) - status.AveragePrice) * float64(size) / float64(status.Filled)
+	status.State = OrderPartiallyFilled
+	if status.Remaining == 0 {
+		status.State = OrderFilled
+	}
+	status.Updated = s.clock.Now()
+}
+
+// Record that some or all of an order's remaining quantity was removed
+// without filling, leaving the order in state once nothing remains.
+func (s *OrderStore) cancel(orderID OrderID, size Size, state OrderState) {
+	status, ok := s.orders[orderID]
+	if !ok || size == 0 {
+		return
+	}
+	if size > status.Remaining {
+		size = status.Remaining
+	}
+	status.Remaining -= size
+	if status.Remaining == 0 {
+		status.State = state
+	}
+	status.Updated = s.clock.Now()
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrderStore(t *testing.T) {
+	var e Engine
+	clock := &fakeClock{now: time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)}
+	e.Orders = NewOrderStore(clock)
+	e.Reset()
+	start := clock.Now()
+
+	b1 := e.Limit(Order{"JPM", "B1", Bid, 100, 10})
+	status, ok := e.Orders.Status(b1)
+	assert.True(t, ok)
+	assert.Equal(t, OrderStatus{OrderID: b1, Symbol: "JPM", Trader: "B1", Side: Bid, Price: 100, State: OrderNew,
+		Quantity: 10, Remaining: 10, Created: start, Updated: start}, status)
+
+	clock.Advance(time.Second)
+	s1 := e.Limit(Order{"JPM", "S1", Ask, 100, 4})
+	s2 := e.Limit(Order{"JPM", "S2", Ask, 99, 2})
+	status, _ = e.Orders.Status(b1)
+	assert.Equal(t, OrderPartiallyFilled, status.State)
+	assert.Equal(t, Size(4), status.Remaining)
+	assert.Equal(t, Size(6), status.Filled)
+	assert.InDelta(t, 99.667, status.AveragePrice, 0.001)
+	assert.Equal(t, start.Add(time.Second), status.Updated)
+	status, _ = e.Orders.Status(s1)
+	assert.Equal(t, OrderFilled, status.State)
+	assert.Equal(t, 100.0, status.AveragePrice)
+
+	// Cancelling keeps the fills, but cancelling a filled order changes
+	// nothing.
+	e.Cancel(b1)
+	e.Cancel(s2)
+	status, _ = e.Orders.Status(b1)
+	assert.Equal(t, OrderCancelled, status.State)
+	assert.Equal(t, Size(0), status.Remaining)
+	assert.Equal(t, Size(6), status.Filled)
+	status, _ = e.Orders.Status(s2)
+	assert.Equal(t, OrderFilled, status.State)
+
+	// The unfilled part of a market order expires.
+	e.Limit(Order{"JPM", "S3", Ask, 101, 5})
+	b2, err := e.Submit(Order{"JPM", "B2", Bid, 0, 8}, OrderOptions{Market: true})
+	assert.NoError(t, err)
+	status, _ = e.Orders.Status(b2)
+	assert.Equal(t, OrderExpired, status.State)
+	assert.Equal(t, Price(0), status.Price)
+	assert.Equal(t, Size(5), status.Filled)
+	assert.Equal(t, Size(0), status.Remaining)
+
+	// A stop order that can't meet its minimum quantity when triggered is
+	// rejected.
+	b3, err := e.Submit(Order{"JPM", "B3", Bid, 105, 10}, OrderOptions{StopPrice: 102, MinQuantity: 10})
+	assert.NoError(t, err)
+	e.Limit(Order{"JPM", "S4", Ask, 102, 1})
+	e.Limit(Order{"JPM", "B4", Bid, 102, 1})
+	status, _ = e.Orders.Status(b3)
+	assert.Equal(t, OrderRejected, status.State)
+
+	// Pegged orders report their current price.
+	e.Limit(Order{"JPM", "B5", Bid, 100, 10})
+	b6, err := e.Submit(Order{"JPM", "B6", Bid, 0, 10}, OrderOptions{Peg: PegPrimary})
+	assert.NoError(t, err)
+	status, _ = e.Orders.Status(b6)
+	assert.Equal(t, Price(100), status.Price)
+	clock.Advance(time.Second)
+	e.Limit(Order{"JPM", "B7", Bid, 101, 10})
+	status, _ = e.Orders.Status(b6)
+	assert.Equal(t, Price(101), status.Price)
+	assert.Equal(t, clock.Now(), status.Updated)
+
+	_, ok = e.Orders.Status(1000)
+	assert.False(t, ok)
+	e.Reset()
+	_, ok = e.Orders.Status(b1)
+	assert.False(t, ok)
+}
+
+func TestOrderStoreSelfTradePrevention(t *testing.T) {
+	var e Engine
+	e.Orders = NewOrderStore(nil)
+	e.Reset()
+	e.SelfTradePrevention = STPDecrement
+
+	s1 := e.Limit(Order{"JPM", "A", Ask, 100, 10})
+	b1 := e.Limit(Order{"JPM", "A", Bid, 100, 4})
+	status, _ := e.Orders.Status(s1)
+	assert.Equal(t, OrderNew, status.State)
+	assert.Equal(t, Size(6), status.Remaining)
+	status, _ = e.Orders.Status(b1)
+	assert.Equal(t, OrderCancelled, status.State)
+	assert.Equal(t, Size(0), status.Filled)
+}
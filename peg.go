@@ -0,0 +1,162 @@
+package main
+
+// Peg selects the reference price that a pegged order tracks.
+type Peg int
+
+const (
+	NoPeg       Peg = iota
+	PegPrimary      // Best price on the order's own side of the book.
+	PegMarket       // Best price on the opposite side of the book.
+	PegMidpoint     // Midpoint of the best Buy and Sell prices.
+)
+
+// struct peggedOrder: Describes a resting order whose price tracks the book.
+type peggedOrder struct {
+	orderID OrderID
+	side    Side
+	price   Price // Current price in the book.
+	limit   Price // Highest Buy or lowest Sell price allowed, 0 if none.
+	peg     Peg
+	offset  int
+}
+
+// Return the price of the best outstanding order on one side of the book
+// that is not itself pegged, which pegged orders use as their reference.
+func (e *Engine) referencePrice(side Side) (Price, bool) {
+	if side == Bid {
+		for price, ok := e.pricePoints.prev(e.bidMax); ok && price >= minPrice; price, ok = e.pricePoints.prev(price - 1) {
+			if e.liveUnpegged(e.pricePoints.get(price), side) {
+				return price, true
+			}
+		}
+	} else {
+		for price, ok := e.pricePoints.next(e.askMin); ok && price <= maxPrice; price, ok = e.pricePoints.next(price + 1) {
+			if e.liveUnpegged(e.pricePoints.get(price), side) {
+				return price, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// Compute the current price of a pegged order: its reference price, moved
+// offset ticks away from the opposite side and kept within its limit price.
+// Pegged orders never take liquidity, so the price is also kept at least one
+// tick behind the opposite side of the book. With an Instrument, the price is
+// rounded onto the tick grid away from the opposite side: down for a Buy,
+// up for a Sell. Reports false if there is no reference price or no valid
+// price.
+func (e *Engine) pegPrice(peg *peggedOrder) (Price, bool) {
+	var reference int64
+	switch peg.peg {
+	case PegPrimary, PegMarket:
+		side := peg.side
+		if peg.peg == PegMarket {
+			side = 1 - side
+		}
+		price, ok := e.referencePrice(side)
+		if !ok {
+			return 0, false
+		}
+		reference = int64(price)
+	case PegMidpoint:
+		bid, ok := e.referencePrice(Bid)
+		if !ok {
+			return 0, false
+		}
+		ask, ok := e.referencePrice(Ask)
+		if !ok {
+			return 0, false
+		}
+		// Round the midpoint away from the opposite side, halving each
+		// price first so that the sum can't overflow.
+		reference = int64(bid/2+ask/2) + int64(bid%2+ask%2)/2
+		if peg.side == Ask {
+			reference = int64(bid/2+ask/2) + int64(bid%2+ask%2+1)/2
+		}
+	default:
+		return 0, false
+	}
+
+	price := reference - int64(peg.offset)
+	if peg.side == Ask {
+		price = reference + int64(peg.offset)
+	}
+
+	if peg.side == Bid {
+		if peg.limit != 0 && price > int64(peg.limit) {
+			price = int64(peg.limit)
+		}
+		if ask, ok := e.bestAsk(); ok && price >= int64(ask) {
+			price = int64(ask) - 1
+		}
+	} else {
+		if peg.limit != 0 && price < int64(peg.limit) {
+			price = int64(peg.limit)
+		}
+		if bid, ok := e.bestBid(); ok && price <= int64(bid) {
+			price = int64(bid) + 1
+		}
+	}
+
+	if price < minPrice || price > int64(maxPrice) {
+		return 0, false
+	}
+	if e.Instrument == nil {
+		return Price(price), true
+	}
+	if peg.side == Bid {
+		rounded := e.Instrument.roundDown(Price(price))
+		return rounded, rounded >= minPrice
+	}
+	rounded := e.Instrument.roundUp(Price(price))
+	return rounded, rounded <= maxPrice
+}
+
+// Reprice pegged orders after the book has changed, in time priority. An
+// order that moves to a new price joins the back of the queue there and an
+// EventRepriced event is published. Orders that can't be priced, because
+// their reference has disappeared, stay where they are. Pegged orders are
+// not repriced while an auction is being called.
+func (e *Engine) repeg() {
+	if len(e.pegs) == 0 || e.phase != Continuous {
+		return
+	}
+
+	pegs := e.pegs[:0]
+	for _, peg := range e.pegs {
+		entry := &e.bookEntries[peg.orderID]
+		if entry.size == 0 {
+			continue // Filled or cancelled.
+		}
+		pegs = append(pegs, peg)
+
+		price, ok := e.pegPrice(&peg)
+		if !ok || price == peg.price {
+			continue
+		}
+
+		ppRemoveOrder(e.pricePoints.get(peg.price), entry)
+		e.rest(entry, peg.side, price)
+		if e.Orders != nil {
+			e.Orders.reprice(peg.orderID, price)
+		}
+		e.publish(MarketDataEvent{Type: EventRepriced, OrderID: peg.orderID, Side: peg.side,
+			Price: price, PrevPrice: peg.price, Size: entry.size})
+		pegs[len(pegs)-1].price = price
+	}
+	e.pegs = pegs
+}
+
+// Report whether a price point holds any outstanding orders on one side of
+// the book that are not pegged.
+func (e *Engine) liveUnpegged(ppEntry *pricePoint, side Side) bool {
+	for _, bookEntry := range [...]*orderBookEntry{ppEntry.listHead, ppEntry.hiddenHead} {
+		for ; bookEntry != nil; bookEntry = bookEntry.next {
+			if bookEntry.size > 0 && bookEntry.side == side && !e.attrs(bookEntry.id).pegged {
+				return true
+			}
+		}
+	}
+	return false
+}
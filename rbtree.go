@@ -0,0 +1,224 @@
+package main
+
+// rbTree is a left-leaning red-black tree keyed by price (Sedgewick, 2008).
+// It holds the price levels of a levelEngine, and the price points outside
+// an Engine's price window.
+type rbTree[V any] struct {
+	root *rbNode[V]
+}
+
+type rbNode[V any] struct {
+	key         Price
+	value       V
+	left, right *rbNode[V]
+	red         bool
+}
+
+func newRBTree() priceLevels {
+	return &rbTree[*level]{}
+}
+
+func (t *rbTree[V]) min() V {
+	if t.root == nil {
+		var none V
+		return none
+	}
+	return rbMin(t.root).value
+}
+
+func (t *rbTree[V]) find(key Price) V {
+	if n := t.node(key); n != nil {
+		return n.value
+	}
+	var none V
+	return none
+}
+
+// Return the entry with a key, or nil if none.
+func (t *rbTree[V]) node(key Price) *rbNode[V] {
+	for n := t.root; n != nil; {
+		switch {
+		case key < n.key:
+			n = n.left
+		case key > n.key:
+			n = n.right
+		default:
+			return n
+		}
+	}
+	return nil
+}
+
+// Return the entry with the smallest key at or above key, or nil if none.
+func (t *rbTree[V]) ceiling(key Price) *rbNode[V] {
+	var found *rbNode[V]
+	for n := t.root; n != nil; {
+		switch {
+		case key < n.key:
+			found, n = n, n.left
+		case key > n.key:
+			n = n.right
+		default:
+			return n
+		}
+	}
+	return found
+}
+
+// Return the entry with the largest key at or below key, or nil if none.
+func (t *rbTree[V]) floor(key Price) *rbNode[V] {
+	var found *rbNode[V]
+	for n := t.root; n != nil; {
+		switch {
+		case key < n.key:
+			n = n.left
+		case key > n.key:
+			found, n = n, n.right
+		default:
+			return n
+		}
+	}
+	return found
+}
+
+func (t *rbTree[V]) insert(key Price, value V) {
+	t.root = rbInsert(t.root, key, value)
+	t.root.red = false
+}
+
+func (t *rbTree[V]) delete(key Price) {
+	if t.node(key) == nil {
+		return
+	}
+	if !rbIsRed(t.root.left) && !rbIsRed(t.root.right) {
+		t.root.red = true
+	}
+	t.root = rbDelete(t.root, key)
+	if t.root != nil {
+		t.root.red = false
+	}
+}
+
+func rbIsRed[V any](n *rbNode[V]) bool {
+	return n != nil && n.red
+}
+
+func rbMin[V any](n *rbNode[V]) *rbNode[V] {
+	for n.left != nil {
+		n = n.left
+	}
+	return n
+}
+
+func rbInsert[V any](n *rbNode[V], key Price, value V) *rbNode[V] {
+	if n == nil {
+		return &rbNode[V]{key: key, value: value, red: true}
+	}
+
+	switch {
+	case key < n.key:
+		n.left = rbInsert(n.left, key, value)
+	case key > n.key:
+		n.right = rbInsert(n.right, key, value)
+	default:
+		n.value = value
+	}
+
+	return rbFixUp(n)
+}
+
+// Delete a key known to be present in the subtree rooted at n.
+func rbDelete[V any](n *rbNode[V], key Price) *rbNode[V] {
+	if key < n.key {
+		if !rbIsRed(n.left) && !rbIsRed(n.left.left) {
+			n = rbMoveRedLeft(n)
+		}
+		n.left = rbDelete(n.left, key)
+	} else {
+		if rbIsRed(n.left) {
+			n = rbRotateRight(n)
+		}
+		if key == n.key && n.right == nil {
+			return nil
+		}
+		if !rbIsRed(n.right) && !rbIsRed(n.right.left) {
+			n = rbMoveRedRight(n)
+		}
+		if key == n.key {
+			m := rbMin(n.right)
+			n.key, n.value = m.key, m.value
+			n.right = rbDeleteMin(n.right)
+		} else {
+			n.right = rbDelete(n.right, key)
+		}
+	}
+	return rbFixUp(n)
+}
+
+func rbDeleteMin[V any](n *rbNode[V]) *rbNode[V] {
+	if n.left == nil {
+		return nil
+	}
+	if !rbIsRed(n.left) && !rbIsRed(n.left.left) {
+		n = rbMoveRedLeft(n)
+	}
+	n.left = rbDeleteMin(n.left)
+	return rbFixUp(n)
+}
+
+func rbRotateLeft[V any](n *rbNode[V]) *rbNode[V] {
+	x := n.right
+	n.right = x.left
+	x.left = n
+	x.red = n.red
+	n.red = true
+	return x
+}
+
+func rbRotateRight[V any](n *rbNode[V]) *rbNode[V] {
+	x := n.left
+	n.left = x.right
+	x.right = n
+	x.red = n.red
+	n.red = true
+	return x
+}
+
+func rbFlipColors[V any](n *rbNode[V]) {
+	n.red = !n.red
+	n.left.red = !n.left.red
+	n.right.red = !n.right.red
+}
+
+func rbMoveRedLeft[V any](n *rbNode[V]) *rbNode[V] {
+	rbFlipColors(n)
+	if rbIsRed(n.right.left) {
+		n.right = rbRotateRight(n.right)
+		n = rbRotateLeft(n)
+		rbFlipColors(n)
+	}
+	return n
+}
+
+func rbMoveRedRight[V any](n *rbNode[V]) *rbNode[V] {
+	rbFlipColors(n)
+	if rbIsRed(n.left.left) {
+		n = rbRotateRight(n)
+		rbFlipColors(n)
+	}
+	return n
+}
+
+// Restore the left-leaning red-black invariants on the way up the tree.
+func rbFixUp[V any](n *rbNode[V]) *rbNode[V] {
+	if rbIsRed(n.right) && !rbIsRed(n.left) {
+		n = rbRotateLeft(n)
+	}
+	if rbIsRed(n.left) && rbIsRed(n.left.left) {
+		n = rbRotateRight(n)
+	}
+	if rbIsRed(n.left) && rbIsRed(n.right) {
+		rbFlipColors(n)
+	}
+	return n
+}
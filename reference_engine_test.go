@@ -0,0 +1,112 @@
+package main
+
+import "sort"
+
+// referenceEngine is a deliberately naive matching engine used as an oracle
+// in differential tests. Each side of the book is a slice of orders sorted
+// by price priority and then by time, and orders are removed eagerly when
+// filled or cancelled.
+type referenceEngine struct {
+	execute func(Execution)
+	bids    []*referenceOrder
+	asks    []*referenceOrder
+	nextID  OrderID
+}
+
+type referenceOrder struct {
+	id     OrderID
+	trader string
+	side   Side
+	price  Price
+	size   Size
+}
+
+func (r *referenceEngine) SetExecute(hook func(Execution)) {
+	r.execute = hook
+}
+
+func (r *referenceEngine) Reset() {
+	r.bids = nil
+	r.asks = nil
+	r.nextID = 0
+}
+
+func (r *referenceEngine) book(side Side) *[]*referenceOrder {
+	if side == Bid {
+		return &r.bids
+	}
+	return &r.asks
+}
+
+// Report whether price a has priority over price b on one side of the book.
+func better(side Side, a, b Price) bool {
+	if side == Bid {
+		return a > b
+	}
+	return a < b
+}
+
+func (r *referenceEngine) Limit(order Order) OrderID {
+	if order.price < minPrice || order.price > maxPrice {
+		return 0
+	}
+	r.nextID++
+	remaining := order.size
+
+	opposite := r.book(1 - order.side)
+	for remaining > 0 && len(*opposite) > 0 && crosses(order, (*opposite)[0].price) {
+		resting := (*opposite)[0]
+
+		fill := resting.size
+		if remaining < fill {
+			fill = remaining
+		}
+		if order.side == Bid {
+			execute(r.execute, nil, order.symbol, order.trader, resting.trader, Bid, order.price, fill)
+		} else {
+			execute(r.execute, nil, order.symbol, resting.trader, order.trader, Ask, order.price, fill)
+		}
+
+		remaining -= fill
+		resting.size -= fill
+		if resting.size == 0 {
+			*opposite = (*opposite)[1:]
+		}
+	}
+
+	if remaining > 0 {
+		book := r.book(order.side)
+		i := sort.Search(len(*book), func(i int) bool {
+			return better(order.side, order.price, (*book)[i].price)
+		})
+		*book = append(*book, nil)
+		copy((*book)[i+1:], (*book)[i:])
+		(*book)[i] = &referenceOrder{r.nextID, order.trader, order.side, order.price, remaining}
+	}
+
+	return r.nextID
+}
+
+func (r *referenceEngine) Cancel(orderID OrderID) {
+	for _, book := range []*[]*referenceOrder{&r.bids, &r.asks} {
+		for i, o := range *book {
+			if o.id == orderID {
+				*book = append((*book)[:i], (*book)[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+func (r *referenceEngine) Depth(side Side) []Level {
+	var levels []Level
+	for _, o := range *r.book(side) {
+		if n := len(levels); n > 0 && levels[n-1].Price == o.price {
+			levels[n-1].Size += o.size
+			levels[n-1].Orders++
+		} else {
+			levels = append(levels, Level{o.price, o.size, 1})
+		}
+	}
+	return levels
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"math/bits"
+	"time"
+)
+
+// RiskLimits are the pre-trade limits applied to one trader's orders. Zero
+// disables a limit.
+type RiskLimits struct {
+	MaxOrderSize  Size
+	MaxNotional   uint64 // Price times size of a single order. Market orders are valued at the reference price, and rejected without one.
+	MaxOpenOrders int
+	MaxPosition   Size // Largest net long or short position if the order and the trader's other open orders on its side fill.
+
+	// Orders may be priced no more than PriceCollar away from the last
+	// trade price or, before the first trade, the best opposite price.
+	PriceCollar Price
+
+	// No more than MaxMessages orders and cancels per RateWindow, which
+	// defaults to one second. Cancels count towards the rate but are never
+	// rejected.
+	MaxMessages int
+	RateWindow  time.Duration
+}
+
+// RiskGateway enforces per-trader RiskLimits in front of an Engine. Orders
+// and cancels must be sent through the gateway for its open order and
+// message counts to be accurate.
+type RiskGateway struct {
+	engine  *Engine
+	clock   Clock
+	limits  RiskLimits      // Default limits.
+	execute func(Execution) // The engine's Execute callback before it was hooked.
+	traders map[string]*traderRisk
+}
+
+// traderRisk holds the state a RiskGateway tracks for one trader.
+type traderRisk struct {
+	limits   *RiskLimits // Overrides the gateway default if not nil.
+	position int64       // Net filled quantity, long positive.
+	open     []OrderID   // Orders that may still be outstanding.
+	messages []time.Time // Recent messages, oldest first.
+}
+
+// NewRiskGateway returns a gateway that applies limits to every trader,
+// until overridden with SetLimits. It tracks positions by hooking the
+// engine's Execute callback, which it still calls after updating the
+// position. Replacing e.Execute afterwards would stop position tracking, so
+// change the callback with SetExecute instead. A nil clock means the wall
+// clock.
+func NewRiskGateway(e *Engine, limits RiskLimits, clock Clock) *RiskGateway {
+	if clock == nil {
+		clock = systemClock{}
+	}
+	g := &RiskGateway{engine: e, clock: clock, limits: limits, execute: e.Execute, traders: make(map[string]*traderRisk)}
+
+	e.Execute = func(x Execution) {
+		if x.side == Bid {
+			g.trader(x.trader).position += int64(x.size)
+		} else {
+			g.trader(x.trader).position -= int64(x.size)
+		}
+		if g.execute != nil {
+			g.execute(x)
+		}
+	}
+	return g
+}
+
+// SetExecute replaces the engine's Execute callback, which is called after
+// the gateway has updated the trader's position.
+func (g *RiskGateway) SetExecute(hook func(Execution)) {
+	g.execute = hook
+}
+
+// SetLimits replaces the limits applied to one trader.
+func (g *RiskGateway) SetLimits(trader string, limits RiskLimits) {
+	g.trader(trader).limits = &limits
+}
+
+// Position returns a trader's net filled quantity, long positive.
+func (g *RiskGateway) Position(trader string) int64 {
+	return g.trader(trader).position
+}
+
+// Submit checks an order against its trader's limits and, if it passes,
+// submits it to the engine. Orders that breach a limit are rejected with a
+// *RejectError.
+func (g *RiskGateway) Submit(order Order, opts OrderOptions) (OrderID, error) {
+	t := g.trader(order.trader)
+	limits := &g.limits
+	if t.limits != nil {
+		limits = t.limits
+	}
+
+	if err := g.check(t, limits, order, &opts); err != nil {
+		return 0, err
+	}
+
+	orderID, err := g.engine.Submit(order, opts)
+	if err == nil && g.engine.outstanding(orderID) > 0 {
+		t.open = append(t.open, orderID)
+	}
+	return orderID, err
+}
+
+// Cancel an outstanding order, counting it towards its trader's message
+// rate.
+func (g *RiskGateway) Cancel(orderID OrderID) {
+	if g.engine.outstanding(orderID) > 0 {
+		t := g.trader(g.engine.bookEntries[orderID].trader)
+		t.messages = append(t.messages, g.clock.Now())
+	}
+	g.engine.Cancel(orderID)
+}
+
+func (g *RiskGateway) trader(name string) *traderRisk {
+	t, ok := g.traders[name]
+	if !ok {
+		t = &traderRisk{}
+		g.traders[name] = t
+	}
+	return t
+}
+
+// Check an incoming order against a trader's limits, recording it as a
+// message whether or not it is accepted.
+func (g *RiskGateway) check(t *traderRisk, limits *RiskLimits, order Order, opts *OrderOptions) error {
+	now := g.clock.Now()
+	window := limits.RateWindow
+	if window == 0 {
+		window = time.Second
+	}
+	for len(t.messages) > 0 && now.Sub(t.messages[0]) >= window {
+		t.messages = t.messages[1:]
+	}
+	t.messages = append(t.messages, now)
+	if limits.MaxMessages > 0 && len(t.messages) > limits.MaxMessages {
+		return &RejectError{Reason: RejectRateLimit,
+			Detail: fmt.Sprintf("%v messages in %v", len(t.messages), window)}
+	}
+
+	if limits.MaxOrderSize > 0 && order.size > limits.MaxOrderSize {
+		return &RejectError{Reason: RejectMaxOrderSize,
+			Detail: fmt.Sprintf("%v exceeds %v", order.size, limits.MaxOrderSize)}
+	}
+
+	reference, haveReference := g.referencePrice(order.side)
+	price := order.price
+	if opts.Market {
+		if limits.MaxNotional > 0 && !haveReference {
+			return &RejectError{Reason: RejectNoReferencePrice}
+		}
+		price = reference
+	}
+	if overflow, notional := bits.Mul64(uint64(price), uint64(order.size)); limits.MaxNotional > 0 && (overflow != 0 || notional > limits.MaxNotional) {
+		return &RejectError{Reason: RejectMaxNotional,
+			Detail: fmt.Sprintf("%v exceeds %v", notional, limits.MaxNotional)}
+	}
+
+	if limits.PriceCollar > 0 && haveReference && !opts.Market && opts.Peg == NoPeg {
+		if order.price > reference && order.price-reference > limits.PriceCollar ||
+			order.price < reference && reference-order.price > limits.PriceCollar {
+			return &RejectError{Reason: RejectPriceCollar,
+				Detail: fmt.Sprintf("price %v more than %v from %v", order.price, limits.PriceCollar, reference)}
+		}
+	}
+
+	if limits.MaxOpenOrders > 0 || limits.MaxPosition > 0 {
+		open := t.open[:0]
+		for _, id := range t.open {
+			if g.engine.outstanding(id) > 0 {
+				open = append(open, id)
+			}
+		}
+		t.open = open
+	}
+
+	if limits.MaxOpenOrders > 0 && len(t.open) >= limits.MaxOpenOrders {
+		return &RejectError{Reason: RejectMaxOpenOrders}
+	}
+
+	if limits.MaxPosition > 0 {
+		// Assume the order and every open order on its side fill.
+		exposure := int64(order.size)
+		for _, id := range t.open {
+			if g.engine.bookEntries[id].side == order.side {
+				exposure += int64(g.engine.outstanding(id))
+			}
+		}
+		position := t.position + exposure
+		if order.side == Ask {
+			position = t.position - exposure
+		}
+		if position > int64(limits.MaxPosition) || -position > int64(limits.MaxPosition) {
+			return &RejectError{Reason: RejectMaxPosition,
+				Detail: fmt.Sprintf("%v exceeds %v", position, limits.MaxPosition)}
+		}
+	}
+
+	return nil
+}
+
+// Return the price that collars and market order notionals are measured
+// against: the last trade price, or before the first trade, the best price
+// on the opposite side of the book.
+func (g *RiskGateway) referencePrice(side Side) (Price, bool) {
+	if g.engine.lastPrice != 0 {
+		return g.engine.lastPrice, true
+	}
+	if side == Bid {
+		return g.engine.bestAsk()
+	}
+	return g.engine.bestBid()
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClock is a Clock that only moves when told to.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func rejectReason(err error) RejectReason {
+	if err, ok := err.(*RejectError); ok {
+		return err.Reason
+	}
+	return 0
+}
+
+func TestRiskGatewayLimits(t *testing.T) {
+	var e Engine
+	e.Reset()
+	executions := recordExecutions(&e)
+	g := NewRiskGateway(&e, RiskLimits{
+		MaxOrderSize:  100,
+		MaxNotional:   101 * 100,
+		MaxOpenOrders: 2,
+		MaxPosition:   150,
+		PriceCollar:   5,
+	}, &fakeClock{})
+
+	_, err := g.Submit(Order{"JPM", "MAX", Ask, 101, 200}, OrderOptions{})
+	assert.Equal(t, RejectMaxOrderSize, rejectReason(err))
+	_, err = g.Submit(Order{"JPM", "MAX", Ask, 101, 100}, OrderOptions{})
+	assert.NoError(t, err)
+	_, err = g.Submit(Order{"JPM", "MAX", Ask, 102, 100}, OrderOptions{})
+	assert.Equal(t, RejectMaxNotional, rejectReason(err))
+	_, err = g.Submit(Order{"JPM", "MAX", Ask, 102, 50}, OrderOptions{})
+	assert.NoError(t, err)
+	_, err = g.Submit(Order{"JPM", "MAX", Ask, 103, 10}, OrderOptions{})
+	assert.Equal(t, RejectMaxOpenOrders, rejectReason(err))
+
+	// Before the first trade, prices are collared around the opposite side.
+	_, err = g.Submit(Order{"JPM", "XAM", Bid, 107, 10}, OrderOptions{})
+	assert.Equal(t, &RejectError{Reason: RejectPriceCollar, Detail: "price 107 more than 5 from 101"}, err)
+
+	_, err = g.Submit(Order{"JPM", "XAM", Bid, 101, 100}, OrderOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, *executions, 2)
+	assert.Equal(t, int64(100), g.Position("XAM"))
+	assert.Equal(t, int64(-100), g.Position("MAX"))
+
+	_, err = g.Submit(Order{"JPM", "XAM", Bid, 102, 60}, OrderOptions{})
+	assert.Equal(t, &RejectError{Reason: RejectMaxPosition, Detail: "160 exceeds 150"}, err)
+
+	// Open orders count towards the position on their side.
+	_, err = g.Submit(Order{"JPM", "MAX", Ask, 103, 10}, OrderOptions{})
+	assert.Equal(t, &RejectError{Reason: RejectMaxPosition, Detail: "-160 exceeds 150"}, err)
+
+	// The filled order no longer counts towards the open orders limit.
+	_, err = g.Submit(Order{"JPM", "MAX", Bid, 99, 10}, OrderOptions{})
+	assert.NoError(t, err)
+
+	// Traders can be given their own limits.
+	g.SetLimits("XAM", RiskLimits{})
+	_, err = g.Submit(Order{"JPM", "XAM", Bid, 120, 500}, OrderOptions{})
+	assert.NoError(t, err)
+}
+
+func TestRiskGatewayMarketOrders(t *testing.T) {
+	var e Engine
+	e.Reset()
+	g := NewRiskGateway(&e, RiskLimits{MaxNotional: 1500}, &fakeClock{})
+
+	// Market orders cannot be valued against an empty book.
+	_, err := g.Submit(Order{"JPM", "XAM", Bid, 0, 10}, OrderOptions{Market: true})
+	assert.Equal(t, RejectNoReferencePrice, rejectReason(err))
+
+	_, err = g.Submit(Order{"JPM", "MAX", Ask, 100, 15}, OrderOptions{})
+	assert.NoError(t, err)
+	_, err = g.Submit(Order{"JPM", "XAM", Bid, 0, 16}, OrderOptions{Market: true})
+	assert.Equal(t, RejectMaxNotional, rejectReason(err))
+
+	// Execute callbacks set through the gateway keep positions tracked.
+	var executions []Execution
+	g.SetExecute(func(x Execution) { executions = append(executions, x) })
+	_, err = g.Submit(Order{"JPM", "XAM", Bid, 0, 10}, OrderOptions{Market: true})
+	assert.NoError(t, err)
+	assert.Len(t, executions, 2)
+	assert.Equal(t, int64(10), g.Position("XAM"))
+}
+
+func TestRiskGatewayRateLimit(t *testing.T) {
+	var e Engine
+	e.Reset()
+	clock := &fakeClock{}
+	g := NewRiskGateway(&e, RiskLimits{MaxMessages: 3, RateWindow: time.Second}, clock)
+
+	id, err := g.Submit(Order{"JPM", "MAX", Ask, 101, 100}, OrderOptions{})
+	assert.NoError(t, err)
+	clock.Advance(500 * time.Millisecond)
+	g.Cancel(id)
+	_, err = g.Submit(Order{"JPM", "MAX", Ask, 101, 100}, OrderOptions{})
+	assert.NoError(t, err)
+	_, err = g.Submit(Order{"JPM", "MAX", Ask, 101, 100}, OrderOptions{})
+	assert.Equal(t, RejectRateLimit, rejectReason(err))
+
+	// Other traders have their own rate.
+	_, err = g.Submit(Order{"JPM", "XAM", Ask, 101, 100}, OrderOptions{})
+	assert.NoError(t, err)
+
+	// Rejected orders count towards the rate too, until they leave the
+	// window.
+	clock.Advance(500 * time.Millisecond)
+	_, err = g.Submit(Order{"JPM", "MAX", Ask, 101, 100}, OrderOptions{})
+	assert.Equal(t, RejectRateLimit, rejectReason(err))
+	clock.Advance(time.Second)
+	_, err = g.Submit(Order{"JPM", "MAX", Ask, 101, 100}, OrderOptions{})
+	assert.NoError(t, err)
+}
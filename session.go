@@ -0,0 +1,140 @@
+package main
+
+import "fmt"
+
+// TradingState is the state of an Engine's trading session, which gates the
+// operations it accepts. Each Engine holds the book for one symbol, so
+// symbols move through their sessions independently.
+//
+// New orders are accepted in StateContinuous, and collected for an auction
+// without matching in StatePreOpen and StateAuction. Orders received in any
+// other state are rejected with RejectTradingState. Cancels are accepted in
+// every state.
+type TradingState int
+
+const (
+	StateContinuous TradingState = iota // Continuous matching.
+	StateClosed                         // Outside the trading session.
+	StatePreOpen                        // Collecting orders for the opening auction.
+	StateAuction                        // Collecting orders for an auction during or at the end of the session.
+	StateHalted                         // Trading halted.
+	StatePostClose                      // After the close.
+)
+
+// Valid trading state transitions. A halted book can move to any state but
+// StateHalted.
+var stateTransitions = map[TradingState][]TradingState{
+	StateContinuous: {StateAuction, StateHalted, StatePostClose},
+	StateClosed:     {StatePreOpen},
+	StatePreOpen:    {StateContinuous, StateHalted, StateClosed},
+	StateAuction:    {StateContinuous, StateHalted, StatePostClose},
+	StateHalted:     {StateContinuous, StatePreOpen, StateAuction, StatePostClose, StateClosed},
+	StatePostClose:  {StateClosed},
+}
+
+func (s TradingState) String() string {
+	switch s {
+	case StateContinuous:
+		return "Continuous"
+	case StateClosed:
+		return "Closed"
+	case StatePreOpen:
+		return "PreOpen"
+	case StateAuction:
+		return "Auction"
+	case StateHalted:
+		return "Halted"
+	case StatePostClose:
+		return "PostClose"
+	default:
+		return fmt.Sprintf("TradingState(%d)", int(s))
+	}
+}
+
+// State returns the state of the engine's trading session.
+func (e *Engine) State() TradingState {
+	return e.state
+}
+
+// SetState moves the trading session to a new state, publishing an
+// EventStateChange event. Moving to StateContinuous from an auction, or from
+// a halt during one, uncrosses the book; leaving an auction for any other
+// state leaves the book as it is. Returns an error for a transition that
+// isn't allowed.
+func (e *Engine) SetState(next TradingState) error {
+	if !e.canEnter(next) {
+		return fmt.Errorf("invalid trading state transition from %v to %v", e.state, next)
+	}
+
+	if e.phase == CallAuction && next == StateContinuous {
+		if result := e.indicative(); result.Volume > 0 {
+			e.uncrossAt(result.Price)
+		}
+	}
+	if next == StateHalted {
+		e.haltedFrom = e.state
+	}
+	e.setState(next)
+
+	if next == StateContinuous {
+		e.triggerStops()
+		e.repeg()
+	}
+	e.debugCheck()
+	return nil
+}
+
+// Halt trading. New orders are rejected until trading resumes.
+func (e *Engine) Halt() error {
+	return e.SetState(StateHalted)
+}
+
+// Resume trading after a halt, returning to the state the book was halted
+// in. A halt during continuous trading is followed by a reopening auction,
+// so the book resumes in StateAuction.
+func (e *Engine) Resume() error {
+	if e.state != StateHalted {
+		return fmt.Errorf("trading is not halted")
+	}
+	next := e.haltedFrom
+	if next == StateContinuous {
+		next = StateAuction
+	}
+	return e.SetState(next)
+}
+
+// Report whether the trading session may move from its current state to
+// next.
+func (e *Engine) canEnter(next TradingState) bool {
+	for _, state := range stateTransitions[e.state] {
+		if state == next {
+			return true
+		}
+	}
+	return false
+}
+
+// Report whether the engine may start an auction of its own accord, as
+// batches and volatility interruptions do. Only SetState and Resume end a
+// halt.
+func (e *Engine) canStartAuction() bool {
+	return e.state != StateHalted && e.canEnter(StateAuction)
+}
+
+// Enter a trading state, setting the matching phase to match. The caller
+// checks that the transition is allowed.
+func (e *Engine) setState(next TradingState) {
+	e.state = next
+	switch next {
+	case StatePreOpen, StateAuction:
+		e.phase = CallAuction
+	case StateHalted, StatePostClose, StateClosed:
+		// Keep the phase, so a book halted or closed during an auction may
+		// stay crossed until it is uncrossed on the way back to
+		// StateContinuous.
+	default:
+		e.phase = Continuous
+	}
+	e.publish(MarketDataEvent{Type: EventStateChange, State: next})
+	e.publishIndicative()
+}
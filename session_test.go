@@ -0,0 +1,94 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTradingSession(t *testing.T) {
+	var e Engine
+	e.Reset()
+	executions := recordExecutions(&e)
+	var states []TradingState
+	e.MarketData = func(event MarketDataEvent) {
+		if event.Type == EventStateChange {
+			states = append(states, event.State)
+		}
+	}
+
+	assert.NoError(t, e.SetState(StatePostClose))
+	assert.NoError(t, e.SetState(StateClosed))
+	_, err := e.Submit(Order{"JPM", "B1", Bid, 100, 10}, OrderOptions{})
+	assert.Equal(t, RejectTradingState, rejectReason(err))
+	assert.Error(t, e.SetState(StateContinuous))
+
+	// Orders collected before the open uncross when continuous trading starts.
+	assert.NoError(t, e.SetState(StatePreOpen))
+	e.Limit(Order{"JPM", "B1", Bid, 101, 10})
+	e.Limit(Order{"JPM", "S1", Ask, 100, 10})
+	assert.Empty(t, *executions)
+	assert.NoError(t, e.SetState(StateContinuous))
+	assert.Equal(t, []Execution{
+		{"JPM", "B1", Bid, 100, 10, Auction, 0}, {"JPM", "S1", Ask, 100, 10, Auction, 0},
+	}, *executions)
+
+	// A halt during continuous trading rejects orders, but not cancels, and
+	// resumes with a reopening auction.
+	id := e.Limit(Order{"JPM", "B2", Bid, 99, 10})
+	assert.NoError(t, e.Halt())
+	_, err = e.Submit(Order{"JPM", "S2", Ask, 99, 10}, OrderOptions{})
+	assert.Equal(t, RejectTradingState, rejectReason(err))
+	e.Cancel(id)
+	assert.Empty(t, e.Depth(Bid))
+	assert.NoError(t, e.Resume())
+	assert.Equal(t, StateAuction, e.State())
+	assert.Equal(t, CallAuction, e.Phase())
+	assert.Error(t, e.Resume())
+	assert.Equal(t, AuctionResult{}, e.Uncross())
+	assert.Equal(t, StateContinuous, e.State())
+
+	assert.Equal(t, []TradingState{StatePostClose, StateClosed, StatePreOpen, StateContinuous,
+		StateHalted, StateAuction, StateContinuous}, states)
+	assert.NoError(t, e.Check())
+}
+
+func TestTradingSessionHaltDuringAuction(t *testing.T) {
+	var e Engine
+	e.Reset()
+	executions := recordExecutions(&e)
+
+	assert.NoError(t, e.StartAuction())
+	e.Limit(Order{"JPM", "B1", Bid, 101, 10})
+	e.Limit(Order{"JPM", "S1", Ask, 100, 10})
+
+	// The book stays crossed through the halt, and uncrosses when
+	// continuous trading resumes.
+	assert.NoError(t, e.Halt())
+	assert.NoError(t, e.Check())
+	assert.NoError(t, e.Resume())
+	assert.Equal(t, StateAuction, e.State())
+	assert.NoError(t, e.Halt())
+	assert.NoError(t, e.SetState(StateContinuous))
+	assert.Len(t, *executions, 2)
+	assert.Empty(t, e.Depth(Bid))
+	assert.NoError(t, e.Check())
+
+	// Closing doesn't uncross the book.
+	*executions = nil
+	assert.NoError(t, e.StartAuction())
+	e.Limit(Order{"JPM", "B2", Bid, 101, 10})
+	e.Limit(Order{"JPM", "S2", Ask, 100, 10})
+	assert.NoError(t, e.SetState(StatePostClose))
+	assert.Empty(t, *executions)
+	assert.NoError(t, e.Check())
+
+	// Starting a batch doesn't end a halt.
+	e.Reset()
+	assert.NoError(t, e.Halt())
+	NewBatchEngine(&e, time.Second, nil)
+	assert.Equal(t, StateHalted, e.State())
+	assert.NoError(t, e.SetState(StateContinuous))
+	assert.Equal(t, StateContinuous, e.State())
+}
@@ -0,0 +1,94 @@
+package main
+
+import "math/rand"
+
+const skipListMaxHeight = 16
+
+// skipList is a probabilistic ordered map of price levels (Pugh, 1990).
+type skipList struct {
+	head   skipNode
+	height int
+	rng    *rand.Rand
+}
+
+type skipNode struct {
+	key   Price
+	level *level
+	next  [skipListMaxHeight]*skipNode
+}
+
+func newSkipList() priceLevels {
+	// Fixed seed so that benchmark runs are repeatable.
+	return &skipList{height: 1, rng: rand.New(rand.NewSource(1))}
+}
+
+func (s *skipList) min() *level {
+	if s.head.next[0] == nil {
+		return nil
+	}
+	return s.head.next[0].level
+}
+
+func (s *skipList) find(key Price) *level {
+	n := &s.head
+	for h := s.height - 1; h >= 0; h-- {
+		for n.next[h] != nil && n.next[h].key < key {
+			n = n.next[h]
+		}
+	}
+	if n = n.next[0]; n != nil && n.key == key {
+		return n.level
+	}
+	return nil
+}
+
+// Fill update with the rightmost node before key at every height.
+func (s *skipList) predecessors(key Price, update *[skipListMaxHeight]*skipNode) {
+	n := &s.head
+	for h := s.height - 1; h >= 0; h-- {
+		for n.next[h] != nil && n.next[h].key < key {
+			n = n.next[h]
+		}
+		update[h] = n
+	}
+}
+
+func (s *skipList) insert(key Price, l *level) {
+	var update [skipListMaxHeight]*skipNode
+	s.predecessors(key, &update)
+
+	if n := update[0].next[0]; n != nil && n.key == key {
+		n.level = l
+		return
+	}
+
+	height := 1
+	for height < skipListMaxHeight && s.rng.Intn(2) == 0 {
+		height++
+	}
+	for ; s.height < height; s.height++ {
+		update[s.height] = &s.head
+	}
+
+	n := &skipNode{key: key, level: l}
+	for h := 0; h < height; h++ {
+		n.next[h] = update[h].next[h]
+		update[h].next[h] = n
+	}
+}
+
+func (s *skipList) delete(key Price) {
+	var update [skipListMaxHeight]*skipNode
+	s.predecessors(key, &update)
+
+	n := update[0].next[0]
+	if n == nil || n.key != key {
+		return
+	}
+	for h := 0; h < s.height && update[h].next[h] == n; h++ {
+		update[h].next[h] = n.next[h]
+	}
+	for s.height > 1 && s.head.next[s.height-1] == nil {
+		s.height--
+	}
+}
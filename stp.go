@@ -0,0 +1,76 @@
+package main
+
+// STPMode selects how self-trade prevention resolves an incoming order that
+// would trade with a resting order in the same self-trade prevention group.
+type STPMode int
+
+const (
+	STPNone         STPMode = iota
+	STPCancelNewest         // Cancel the rest of the incoming order.
+	STPCancelOldest         // Cancel the resting order and continue matching.
+	STPCancelBoth           // Cancel both orders.
+	STPDecrement            // Reduce both orders by the smaller quantity, cancelling the smaller.
+)
+
+// Return the self-trade prevention group of an incoming order, which is its
+// trader unless another group was given.
+func stpGroup(order Order, opts *OrderOptions) string {
+	if opts.STPGroup != "" {
+		return opts.STPGroup
+	}
+	return order.trader
+}
+
+// Resolve an attempted self-trade between an incoming order and a resting
+// book entry, returning the remaining size of the incoming order. When the
+// incoming order has size left, the book entry has been cancelled.
+func (e *Engine) preventSelfTrade(orderID OrderID, order Order, orderSize Size, bookEntry *orderBookEntry) Size {
+	incoming := CancelReport{OrderID: orderID, Trader: order.trader, Side: order.side, Price: order.price,
+		Reason: CancelSelfTrade}
+	resting := CancelReport{OrderID: bookEntry.id, Trader: bookEntry.trader, Side: bookEntry.side,
+		Price: bookEntry.price, Reason: CancelSelfTrade}
+
+	restingSize := bookEntry.size + bookEntry.reserve
+	switch e.SelfTradePrevention {
+	case STPCancelNewest:
+		incoming.Size = orderSize
+	case STPCancelOldest:
+		resting.Size = restingSize
+	case STPCancelBoth:
+		incoming.Size = orderSize
+		resting.Size = restingSize
+	case STPDecrement:
+		resting.Size = restingSize
+		if orderSize < restingSize {
+			resting.Size = orderSize
+		}
+		incoming.Size = resting.Size
+	}
+
+	if resting.Size == restingSize {
+		bookEntry.size = 0
+		bookEntry.reserve = 0
+	} else if resting.Size > 0 {
+		// Take the decrement from an iceberg's reserve first, so that the
+		// displayed slice keeps its place in the queue.
+		fromReserve := bookEntry.reserve
+		if resting.Size < fromReserve {
+			fromReserve = resting.Size
+		}
+		bookEntry.reserve -= fromReserve
+		bookEntry.size -= resting.Size - fromReserve
+	}
+	e.reportCancel(resting)
+	e.reportCancel(incoming)
+	return orderSize - incoming.Size
+}
+
+// Report an order cancelled by the engine, skipping empty reports.
+func (e *Engine) reportCancel(report CancelReport) {
+	if e.Orders != nil {
+		e.Orders.cancel(report.OrderID, report.Size, OrderCancelled)
+	}
+	if e.Cancelled != nil && report.Size > 0 {
+		e.Cancelled(report)
+	}
+}
@@ -4,7 +4,7 @@ import (
 	"fmt"
 )
 
-type Price uint16 // 0-65536 eg the price 123.45 = 12345
+type Price uint64 // 1 to maxPrice eg the price 123.45 = 12345 (see Instrument)
 type OrderID uint64
 type Size uint64
 type Side int
@@ -18,7 +18,119 @@ type Order struct {
 }
 
 // Execution Report (send one per opposite-sided order completely filled).
-type Execution Order
+type Execution struct {
+	symbol    string
+	trader    string
+	side      Side
+	price     Price
+	size      Size
+	liquidity Liquidity
+	fee       float64 // Set if the engine has a fee schedule. Negative for a rebate.
+}
+
+// OrderOptions carries optional instructions for an incoming limit order.
+// The zero value describes a plain, fully displayed limit order.
+type OrderOptions struct {
+	// Iceberg orders: the size of each displayed slice, with the rest of the
+	// order held in reserve. Zero displays the whole order.
+	DisplaySize Size
+
+	// Market orders trade at any price, ignoring the order's price, and any
+	// unfilled remainder is discarded rather than resting in the book.
+	Market bool
+
+	// Stop orders are held off the book until an execution at or beyond
+	// StopPrice (at or above for a Buy, at or below for a Sell), then enter
+	// the book as a limit order, or as a market order if Market is set.
+	StopPrice Price
+
+	// Post-only orders must not trade on arrival. See PostOnly.
+	PostOnly PostOnly
+
+	// Hidden orders rest and match like any other order, but are never shown
+	// in depth snapshots and match only after all displayed orders at the
+	// same price.
+	Hidden bool
+
+	// Pegged orders rest at a price that tracks the book, PegOffset ticks
+	// behind the reference price selected by Peg, and are repriced whenever
+	// the reference moves. A non-zero order price caps a Buy peg and floors a
+	// Sell peg.
+	Peg       Peg
+	PegOffset int
+
+	// Minimum quantity orders are rejected unless at least MinQuantity can
+	// be filled on arrival. Any remainder rests as a plain limit order.
+	MinQuantity Size
+
+	// All-or-none orders only trade if they can be filled completely in one
+	// go. An all-or-none order that can't be filled on arrival rests without
+	// trading, and is skipped by incoming orders too small to fill it. The
+	// book may be left crossed around all-or-none orders.
+	AllOrNone bool
+
+	// The self-trade prevention group of the order, which defaults to its
+	// trader. See Engine.SelfTradePrevention.
+	STPGroup string
+}
+
+// PostOnly selects how a post-only order that would cross the book on
+// arrival is handled.
+type PostOnly int
+
+const (
+	NotPostOnly    PostOnly = iota
+	PostOnlyReject          // Reject the order.
+	PostOnlySlide           // Reprice one tick behind the opposite side.
+)
+
+// RejectReason explains why an order was not accepted.
+type RejectReason int
+
+const (
+	RejectInvalidPrice     RejectReason = iota + 1 // Price outside [minPrice, maxPrice].
+	RejectBookFull                                 // Order arena exhausted.
+	RejectInvalidOptions                           // Inconsistent OrderOptions.
+	RejectWouldCross                               // Post-only order would trade.
+	RejectMinQuantity                              // Minimum quantity not available.
+	RejectMaxOrderSize                             // Risk limit: order too large.
+	RejectMaxNotional                              // Risk limit: order value too large.
+	RejectMaxOpenOrders                            // Risk limit: too many open orders.
+	RejectMaxPosition                              // Risk limit: position would be too large.
+	RejectPriceCollar                              // Risk limit: price too far from the market.
+	RejectRateLimit                                // Risk limit: too many messages.
+	RejectTradingState                             // Not accepted in the session's trading state.
+	RejectTickSize                                 // Price not on the instrument's tick size.
+	RejectLotSize                                  // Quantity not a multiple of the instrument's lot size.
+	RejectNotConnected                             // Gateway session not connected.
+	RejectNoReferencePrice                         // Risk limit: no price to value a market order at.
+)
+
+// RejectError is returned for orders that were not accepted.
+type RejectError struct {
+	Reason RejectReason
+	Detail string // Optional human-readable elaboration.
+}
+
+// CancelReason explains why the engine cancelled an order.
+type CancelReason int
+
+const (
+	CancelSelfTrade  CancelReason = iota + 1 // Self-trade prevention.
+	CancelMassCancel                         // Mass cancel request.
+	CancelDisconnect                         // Gateway session disconnected.
+)
+
+// CancelReport describes (part of) an order cancelled by the engine. Size is
+// the quantity cancelled, which may leave the rest of the order in the book.
+type CancelReport struct {
+	OrderID OrderID
+	Trader  string
+	Side    Side
+	Price   Price
+	Size    Size
+	Reason  CancelReason
+}
 
 const (
 	Bid Side = iota
@@ -41,3 +153,62 @@ func (s Side) String() string {
 		return "Ask"
 	}
 }
+
+func (r RejectReason) String() string {
+	switch r {
+	case RejectInvalidPrice:
+		return "invalid price"
+	case RejectBookFull:
+		return "book full"
+	case RejectInvalidOptions:
+		return "invalid options"
+	case RejectWouldCross:
+		return "would cross"
+	case RejectMinQuantity:
+		return "minimum quantity not available"
+	case RejectMaxOrderSize:
+		return "maximum order size exceeded"
+	case RejectMaxNotional:
+		return "maximum notional exceeded"
+	case RejectMaxOpenOrders:
+		return "maximum open orders exceeded"
+	case RejectMaxPosition:
+		return "maximum position exceeded"
+	case RejectPriceCollar:
+		return "outside price collar"
+	case RejectRateLimit:
+		return "message rate exceeded"
+	case RejectTradingState:
+		return "trading state"
+	case RejectTickSize:
+		return "invalid tick size"
+	case RejectLotSize:
+		return "invalid lot size"
+	case RejectNotConnected:
+		return "session not connected"
+	case RejectNoReferencePrice:
+		return "no reference price"
+	default:
+		return fmt.Sprintf("RejectReason(%d)", int(r))
+	}
+}
+
+func (r CancelReason) String() string {
+	switch r {
+	case CancelSelfTrade:
+		return "self-trade prevention"
+	case CancelMassCancel:
+		return "mass cancel"
+	case CancelDisconnect:
+		return "session disconnected"
+	default:
+		return fmt.Sprintf("CancelReason(%d)", int(r))
+	}
+}
+
+func (err *RejectError) Error() string {
+	if err.Detail != "" {
+		return fmt.Sprintf("order rejected: %v: %v", err.Reason, err.Detail)
+	}
+	return fmt.Sprintf("order rejected: %v", err.Reason)
+}
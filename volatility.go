@@ -0,0 +1,58 @@
+package main
+
+// VolatilityBands are price bands around the trading price. An incoming
+// order that would trade outside them doesn't trade there: the engine
+// interrupts continuous trading and begins a volatility auction instead, in
+// StateAuction. Whatever remains of the order when trading is interrupted
+// rests in the auction, unless it is a market order.
+//
+// The engine has no clock, so a volatility auction lasts until Uncross (or
+// SetState(StateContinuous)) is called. To run auctions of a fixed length,
+// watch for EventVolatilityAuction events and end each auction when its time
+// is up.
+//
+// Bands are widths in ticks either side of the reference price. A zero width
+// disables the band.
+type VolatilityBands struct {
+	Reference Price // Static band reference, such as the previous close. 0 if none.
+	Static    Price // Static band: furthest distance from Reference.
+	Dynamic   Price // Dynamic band: furthest distance from the last trade price.
+}
+
+// Report whether any price band is enabled.
+func (bands *VolatilityBands) enabled() bool {
+	return bands.Static > 0 && bands.Reference != 0 || bands.Dynamic > 0
+}
+
+// Report whether a trade at price would be within the price bands, given the
+// last trade price before the incoming order (0 if none).
+func (e *Engine) withinBands(price, lastPrice Price) bool {
+	bands := &e.Bands
+	if bands.Static > 0 && bands.Reference != 0 && distance(price, bands.Reference) > bands.Static {
+		return false
+	}
+	if bands.Dynamic > 0 && lastPrice != 0 && distance(price, lastPrice) > bands.Dynamic {
+		return false
+	}
+	return true
+}
+
+// Interrupt continuous trading with a volatility auction, because an
+// incoming order would have traded at price, outside the price bands. The
+// order stops matching either way, but a halted session stays halted.
+func (e *Engine) interrupt(side Side, price Price) {
+	if !e.canStartAuction() {
+		return
+	}
+	e.publish(MarketDataEvent{Type: EventVolatilityAuction, Side: side, Price: price})
+	e.setState(StateAuction)
+}
+
+// Return the price an incoming order trades at against the orders at a
+// price level: its own price, or the level's price for a market order.
+func tradePrice(order Order, opts *OrderOptions, level Price) Price {
+	if opts.Market {
+		return level
+	}
+	return order.price
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVolatilityAuction(t *testing.T) {
+	var e Engine
+	e.Reset()
+	e.Bands = VolatilityBands{Reference: 100, Static: 20, Dynamic: 5}
+	executions := recordExecutions(&e)
+	var events []MarketDataEvent
+	e.MarketData = func(event MarketDataEvent) { events = append(events, event) }
+
+	e.Limit(Order{"JPM", "S0", Ask, 100, 1})
+	e.Limit(Order{"JPM", "B0", Bid, 100, 1})
+	e.Limit(Order{"JPM", "S1", Ask, 101, 10})
+	e.Limit(Order{"JPM", "S2", Ask, 103, 10})
+	e.Limit(Order{"JPM", "S3", Ask, 110, 10})
+	*executions = nil
+
+	// The market order sweeps the book until the next trade would be more
+	// than 5 from the last trade price before it arrived.
+	_, err := e.Submit(Order{"JPM", "B1", Bid, 0, 30}, OrderOptions{Market: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []Execution{
+		{"JPM", "B1", Bid, 101, 10, Taker, 0}, {"JPM", "S1", Ask, 101, 10, Maker, 0},
+		{"JPM", "B1", Bid, 103, 10, Taker, 0}, {"JPM", "S2", Ask, 103, 10, Maker, 0},
+	}, *executions)
+	assert.Equal(t, StateAuction, e.State())
+	assert.Equal(t, MarketDataEvent{Type: EventVolatilityAuction, Side: Bid, Price: 110}, events[len(events)-4])
+	assert.Equal(t, MarketDataEvent{Type: EventStateChange, State: StateAuction}, events[len(events)-3])
+
+	e.Limit(Order{"JPM", "B2", Bid, 112, 5})
+	assert.NoError(t, e.Check())
+	*executions = nil
+	assert.Equal(t, AuctionResult{Price: 110, Volume: 5, Imbalance: 5, ImbalanceSide: Ask}, e.Uncross())
+	assert.Len(t, *executions, 2)
+
+	// 110 is within 5 of the last trade, but a limit order at 121 would trade
+	// outside the static band.
+	*executions = nil
+	e.Limit(Order{"JPM", "B3", Bid, 121, 5})
+	assert.Empty(t, *executions)
+	assert.Equal(t, StateAuction, e.State())
+	assert.Equal(t, []Level{{121, 5, 1}}, e.Depth(Bid))
+	assert.NoError(t, e.Check())
+}
+
+func TestVolatilityAuctionHoldsStops(t *testing.T) {
+	var e Engine
+	e.Reset()
+	e.Bands = VolatilityBands{Dynamic: 5}
+	executions := recordExecutions(&e)
+
+	e.Limit(Order{"JPM", "S0", Ask, 100, 1})
+	e.Limit(Order{"JPM", "B0", Bid, 100, 1})
+	e.Limit(Order{"JPM", "S1", Ask, 102, 10})
+	e.Limit(Order{"JPM", "S2", Ask, 110, 10})
+	_, err := e.Submit(Order{"JPM", "B1", Bid, 0, 5}, OrderOptions{Market: true, StopPrice: 102})
+	assert.NoError(t, err)
+	_, err = e.Submit(Order{"JPM", "B2", Bid, 110, 5}, OrderOptions{StopPrice: 102})
+	assert.NoError(t, err)
+	*executions = nil
+
+	// Both stops trigger. B1 would trade at 110, outside the band, so
+	// trading is interrupted and B2 is held until the auction ends.
+	e.Limit(Order{"JPM", "B3", Bid, 102, 10})
+	assert.Len(t, *executions, 2)
+	assert.Equal(t, StateAuction, e.State())
+	assert.Len(t, e.stops, 1)
+
+	// The auction moves the last trade price close enough for B2.
+	e.Limit(Order{"JPM", "B4", Bid, 108, 1})
+	e.Limit(Order{"JPM", "S3", Ask, 108, 1})
+	*executions = nil
+	e.Uncross()
+	assert.Equal(t, []Execution{
+		{"JPM", "B4", Bid, 108, 1, Auction, 0}, {"JPM", "S3", Ask, 108, 1, Auction, 0},
+		{"JPM", "B2", Bid, 110, 5, Taker, 0}, {"JPM", "S2", Ask, 110, 5, Maker, 0},
+	}, *executions)
+	assert.Empty(t, e.stops)
+	assert.Equal(t, StateContinuous, e.State())
+	assert.NoError(t, e.Check())
+}
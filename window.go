@@ -0,0 +1,167 @@
+package main
+
+// windowSize is the number of prices held in the array of a priceWindow.
+const windowSize = 1 << 16
+
+// priceWindow holds the price points of an Engine's book. Prices range over
+// 64 bits, so rather than an array indexed by every possible price, a
+// window of windowSize consecutive prices around the active part of the book
+// is held in an array, giving constant time access to the price points that
+// matching touches most. Price points outside the window, for orders resting
+// far from the market, are held in a red-black tree.
+//
+// The window tracks the range of its prices that have been used since it was
+// last cleared, and every price in that range has a price point; outside the
+// window, only prices that have held orders do. next and prev step through
+// the prices that have price points, so searches of the book skip the gaps
+// between distant prices, and clearing or moving the window only touches
+// the used range.
+type priceWindow struct {
+	base    Price // Lowest price in the window.
+	lo, hi  Price // Used range of the window, as offsets from base. Empty if lo > hi.
+	window  [windowSize]pricePoint
+	outside rbTree[*pricePoint]
+}
+
+// Clear every price point and move the window back to the lowest prices.
+func (w *priceWindow) reset() {
+	if w.lo <= w.hi {
+		used := w.window[w.lo : w.hi+1]
+		for i := range used {
+			used[i] = pricePoint{}
+		}
+	}
+	w.base = 0
+	w.lo, w.hi = windowSize, 0
+	w.outside = rbTree[*pricePoint]{}
+}
+
+// Report whether a price is in the window.
+func (w *priceWindow) contains(price Price) bool {
+	return price >= w.base && price-w.base < windowSize
+}
+
+// Return the price point at a price, or nil if there is none.
+func (w *priceWindow) get(price Price) *pricePoint {
+	if w.contains(price) {
+		return &w.window[price-w.base]
+	}
+	return w.outside.find(price)
+}
+
+// Return the price point at a price, adding an empty one if necessary.
+func (w *priceWindow) at(price Price) *pricePoint {
+	if w.contains(price) {
+		i := price - w.base
+		if i < w.lo {
+			w.lo = i
+		}
+		if i > w.hi {
+			w.hi = i
+		}
+		return &w.window[i]
+	}
+	ppEntry := w.outside.find(price)
+	if ppEntry == nil {
+		ppEntry = new(pricePoint)
+		w.outside.insert(price, ppEntry)
+	}
+	return ppEntry
+}
+
+// Discard the price point at a price, which must hold no orders. A price
+// point in the window is just cleared, narrowing the used range if it is at
+// either end.
+func (w *priceWindow) remove(price Price) {
+	if !w.contains(price) {
+		w.outside.delete(price)
+		return
+	}
+	i := price - w.base
+	w.window[i] = pricePoint{}
+	if i == w.lo {
+		w.lo++
+	} else if i == w.hi {
+		w.hi--
+	}
+}
+
+// Return the lowest price at or above price that has a price point.
+func (w *priceWindow) next(price Price) (Price, bool) {
+	if w.lo > w.hi {
+		return w.outsideNext(price)
+	}
+	lo, hi := w.base+w.lo, w.base+w.hi
+	if price >= lo && price <= hi {
+		return price, true
+	}
+	if price > hi {
+		return w.outsideNext(price)
+	}
+	if n := w.outside.ceiling(price); n != nil && n.key < lo {
+		return n.key, true
+	}
+	return lo, true
+}
+
+// Return the highest price at or below price that has a price point.
+func (w *priceWindow) prev(price Price) (Price, bool) {
+	if w.lo > w.hi {
+		return w.outsidePrev(price)
+	}
+	lo, hi := w.base+w.lo, w.base+w.hi
+	if price >= lo && price <= hi {
+		return price, true
+	}
+	if price < lo {
+		return w.outsidePrev(price)
+	}
+	if n := w.outside.floor(price); n != nil && n.key > hi {
+		return n.key, true
+	}
+	return hi, true
+}
+
+// Return the lowest price at or above price in the tree.
+func (w *priceWindow) outsideNext(price Price) (Price, bool) {
+	if n := w.outside.ceiling(price); n != nil {
+		return n.key, true
+	}
+	return 0, false
+}
+
+// Return the highest price at or below price in the tree.
+func (w *priceWindow) outsidePrev(price Price) (Price, bool) {
+	if n := w.outside.floor(price); n != nil {
+		return n.key, true
+	}
+	return 0, false
+}
+
+// Move the window so that it is centred on a price, moving the price points
+// that leave the window into the tree and those that enter it out of the
+// tree. Price points move by value, so pointers to them are invalidated.
+func (w *priceWindow) slide(center Price) {
+	base := Price(0)
+	if center > windowSize/2 {
+		base = center - windowSize/2
+	}
+	if base > maxPrice-windowSize+1 {
+		base = maxPrice - windowSize + 1
+	}
+
+	var prices []Price
+	var ppEntries []pricePoint
+	for price, ok := w.next(0); ok; price, ok = w.next(price + 1) {
+		if ppEntry := w.get(price); ppEntry.listHead != nil || ppEntry.hiddenHead != nil {
+			prices = append(prices, price)
+			ppEntries = append(ppEntries, *ppEntry)
+		}
+	}
+
+	w.reset()
+	w.base = base
+	for i, price := range prices {
+		*w.at(price) = ppEntries[i]
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWidePrices(t *testing.T) {
+	var e Engine
+	e.Reset()
+	executions := recordExecutions(&e)
+
+	// The first orders are far above the initial window, which follows them.
+	e.Limit(Order{"BRK", "S1", Ask, 70000000, 10})
+	e.Limit(Order{"BRK", "S2", Ask, 70000005, 10})
+	e.Limit(Order{"BRK", "B1", Bid, 69999990, 10})
+	assert.True(t, e.pricePoints.contains(70000000))
+	assert.NoError(t, e.Check())
+
+	// Orders far from the market rest in the tree.
+	e.Limit(Order{"BRK", "S3", Ask, maxPrice, 10})
+	e.Limit(Order{"BRK", "S4", Ask, 90000000000, 10})
+	e.Limit(Order{"BRK", "B2", Bid, 5, 10})
+	assert.Nil(t, e.pricePoints.outside.find(70000000))
+	assert.NotNil(t, e.pricePoints.outside.find(90000000000))
+	assert.Equal(t, []Level{{70000000, 10, 1}, {70000005, 10, 1}, {90000000000, 10, 1}, {maxPrice, 10, 1}}, e.Depth(Ask))
+	assert.Equal(t, []Level{{69999990, 10, 1}, {5, 10, 1}}, e.Depth(Bid))
+	assert.NoError(t, e.Check())
+
+	// A market order sweeps from the window into the tree.
+	_, err := e.Submit(Order{"BRK", "B3", Bid, 0, 35}, OrderOptions{Market: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []Execution{
+		{"BRK", "B3", Bid, 70000000, 10, Taker, 0}, {"BRK", "S1", Ask, 70000000, 10, Maker, 0},
+		{"BRK", "B3", Bid, 70000005, 10, Taker, 0}, {"BRK", "S2", Ask, 70000005, 10, Maker, 0},
+		{"BRK", "B3", Bid, 90000000000, 10, Taker, 0}, {"BRK", "S4", Ask, 90000000000, 10, Maker, 0},
+		{"BRK", "B3", Bid, maxPrice, 5, Taker, 0}, {"BRK", "S3", Ask, maxPrice, 5, Maker, 0},
+	}, *executions)
+	assert.Nil(t, e.pricePoints.outside.find(90000000000))
+	assert.Equal(t, []Level{{maxPrice, 5, 1}}, e.Depth(Ask))
+	assert.NoError(t, e.Check())
+
+	// Once the market has left the window, the window moves to the next
+	// order, taking price points from the tree.
+	e.Cancel(3)
+	e.Limit(Order{"BRK", "B4", Bid, 6, 10})
+	assert.True(t, e.pricePoints.contains(5))
+	assert.Nil(t, e.pricePoints.outside.find(5))
+	assert.Equal(t, []Level{{6, 10, 1}, {5, 10, 1}}, e.Depth(Bid))
+	assert.NoError(t, e.Check())
+
+	e.Limit(Order{"BRK", "S5", Ask, 5, 20})
+	assert.Len(t, *executions, 12)
+	assert.Empty(t, e.Depth(Bid))
+	assert.NoError(t, e.Check())
+}
+
+func TestWidePriceAuction(t *testing.T) {
+	var e Engine
+	e.Reset()
+	e.StartAuction()
+
+	// Prices in the gap between levels are candidates too: 1000 can trade at
+	// any price from 100 to 1000000, and the reference price is the middle.
+	e.Limit(Order{"BRK", "B1", Bid, 1000000, 1000})
+	e.Limit(Order{"BRK", "S1", Ask, 100, 1000})
+	assert.Equal(t, AuctionResult{Price: 500050, Volume: 1000}, e.Uncross())
+}